@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"errors"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	uuid "github.com/nu7hatch/gouuid"
 )
 
 // Mime types for different files
@@ -67,19 +69,22 @@ func APIConnect(c *gin.Context) {
 		return
 	}
 
-	clientKey, err := NewClientFromURL(url)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, Error{err.Error()})
-		return
+	readOnly := options.ReadOnly
+	if value := c.Request.FormValue("readonly"); value != "" && !readOnly {
+		var err error
+		readOnly, err = strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, NewError(err))
+			return
+		}
 	}
 
-	client := dbClientMap[clientKey]
-
-	err = client.Test()
+	client, err := NewClientFromURL(url)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, Error{err.Error()})
 		return
 	}
+	client.readOnly = readOnly
 
 	user, host, database, port := getConnParametersFromString(url)
 	dbConn := Connection{
@@ -87,12 +92,36 @@ func APIConnect(c *gin.Context) {
 		Port:     port,
 		Username: user,
 		Database: database,
-		ConnID:   clientKey,
+		ReadOnly: readOnly,
 	}
 
-	dbConnArr = append(dbConnArr, dbConn)
+	registerClient(c, client, dbConn)
+}
+
+// registerClient tests the connection of the new client and adds it to the
+// registry, responding with the server info and the connection ID. The
+// client is closed on failure.
+func registerClient(c *gin.Context, client *Client, dbConn Connection) {
+	err := client.Test()
+	if err != nil {
+		client.Close()
+		c.JSON(http.StatusBadRequest, Error{err.Error()})
+		return
+	}
 
 	info, err := client.Info()
+	if err != nil {
+		client.Close()
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	clientKey, err := registry.Add(client, dbConn)
+	if err != nil {
+		client.Close()
+		c.JSON(http.StatusServiceUnavailable, NewError(err))
+		return
+	}
 
 	formatedRes := info.Format()[0]
 
@@ -102,24 +131,23 @@ func APIConnect(c *gin.Context) {
 }
 
 func APIClose(c *gin.Context) {
-	// Read client id from the headers
-	dbClientKey := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[dbClientKey]
+	// Closing the connection would silently roll back the open transaction
+	force, _ := strconv.ParseBool(c.Request.FormValue("force"))
+	if !force && getClient(c).InTransaction() {
+		c.JSON(http.StatusConflict, Error{"A transaction is open, commit or roll it back before disconnecting"})
+		return
+	}
+
+	dbClient := registry.Remove(getConnID(c))
+	if dbClient == nil {
+		c.JSON(http.StatusNotFound, Error{"Connection not found"})
+		return
+	}
 
 	err := dbClient.Close()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, NewError(err))
-	}
-
-	// Remove from
-	delete(dbClientMap, dbClientKey)
-	for index, element := range dbConnArr {
-		thisConnId := element.ConnID
-
-		if thisConnId == dbClientKey {
-			dbConnArr = append(dbConnArr[:index], dbConnArr[index+1:]...)
-			break
-		}
+		return
 	}
 
 	c.Writer.WriteHeader(http.StatusNoContent)
@@ -127,9 +155,7 @@ func APIClose(c *gin.Context) {
 
 // APIGetDatabases will get you all databases in system
 func APIGetDatabases(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	names, err := dbClient.Databases()
 	if err != nil {
@@ -142,9 +168,7 @@ func APIGetDatabases(c *gin.Context) {
 
 // APIGetDatabaseTables will give the tables of a database
 func APIGetDatabaseTables(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	res, err := dbClient.DatabaseTables(c.Params.ByName("database"))
 	if err != nil {
@@ -157,9 +181,7 @@ func APIGetDatabaseTables(c *gin.Context) {
 
 // APIGetDatabaseViews will give the views of a database
 func APIGetDatabaseViews(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	res, err := dbClient.DatabaseViews(c.Params.ByName("database"))
 	if err != nil {
@@ -172,9 +194,7 @@ func APIGetDatabaseViews(c *gin.Context) {
 
 // APIGetDatabaseProcedures will give the stored procedures of a database
 func APIGetDatabaseProcedures(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	res, err := dbClient.DatabaseProcedures(c.Params.ByName("database"))
 	if err != nil {
@@ -187,9 +207,7 @@ func APIGetDatabaseProcedures(c *gin.Context) {
 
 // APIGetDatabaseFunctions will give the functions of a database
 func APIGetDatabaseFunctions(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	res, err := dbClient.DatabaseFunctions(c.Params.ByName("database"))
 	if err != nil {
@@ -203,7 +221,7 @@ func APIGetDatabaseFunctions(c *gin.Context) {
 // APISetDefaultDatabase will set the database as default db for connection
 func APISetDefaultDatabase(c *gin.Context) {
 	dbName := c.Params.ByName("database")
-	query := fmt.Sprintf("use %s;", dbName)
+	query := fmt.Sprintf(MySQLUseDatabase, quoteIdentifier(dbName))
 
 	APIHandleQuery(query, c)
 }
@@ -244,9 +262,7 @@ func APIExplainQuery(c *gin.Context) {
 }
 
 func APIGetColumnOfTable(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	res, err := dbClient.TableColumns(c.Params.ByName("database"), c.Params.ByName("table"))
 	if err != nil {
@@ -259,9 +275,7 @@ func APIGetColumnOfTable(c *gin.Context) {
 
 // APIGetTableInfo returns info about table like row_count, data size etc.
 func APIGetTableInfo(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	res, err := dbClient.TableInfo(c.Params.ByName("table"))
 	if err != nil {
@@ -272,26 +286,66 @@ func APIGetTableInfo(c *gin.Context) {
 	c.JSON(http.StatusOK, res.Format()[0])
 }
 
-// APIHistory will return query history of current dbClient
+// APIHistory searches the query history of the host and user of the
+// current dbClient, newest first. q matches part of the query, database
+// restricts to a database and before pages through older entries by ID.
+// Internal queries are only listed with internal=true.
 func APIHistory(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
+
+	filter := HistoryFilter{
+		Text:     c.Query("q"),
+		Database: c.Query("database"),
+		Limit:    defaultHistoryLimit,
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			c.JSON(http.StatusBadRequest, Error{"Invalid limit"})
+			return
+		}
+		filter.Limit = value
+	}
+
+	if internal := c.Query("internal"); internal != "" {
+		value, err := strconv.ParseBool(internal)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Error{"Invalid internal value"})
+			return
+		}
+		filter.Internal = value
+	}
 
-	c.JSON(http.StatusOK, dbClient.history)
+	if before := c.Query("before"); before != "" {
+		value, err := strconv.ParseInt(before, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Error{"Invalid before value"})
+			return
+		}
+		filter.Before = value
+	}
+
+	entries, err := dbClient.History(filter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
 }
 
 // APIInfo returns information about the current db connecction
 func APIInfo(c *gin.Context) {
 	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	yoConnID := connectionID(c)
+	dbClient := registry.Get(yoConnID)
 
 	if dbClient == nil {
 		// Also send the available connections list
 
 		formatedRes := &Info{
-			Connection: dbConnArr,
+			Connection: registry.Connections(),
 		}
 
 		c.JSON(http.StatusBadRequest, formatedRes)
@@ -308,15 +362,14 @@ func APIInfo(c *gin.Context) {
 
 	formatedRes["host"] = dbClient.host
 	formatedRes["user"] = dbClient.user
+	formatedRes["transaction"] = dbClient.Transaction()
 
 	c.JSON(http.StatusOK, formatedRes)
 }
 
 // APITableIndexes returns the indexs of a table
 func APITableIndexes(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	res, err := dbClient.TableIndexes(c.Params.ByName("table"))
 	if err != nil {
@@ -329,9 +382,7 @@ func APITableIndexes(c *gin.Context) {
 
 // APIProcedureParameters returns the parameters of a procedure
 func APIProcedureParameters(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	res, err := dbClient.ProcedureParameters(c.Params.ByName("procedure"), c.Request.FormValue("database"))
 	if err != nil {
@@ -345,9 +396,7 @@ func APIProcedureParameters(c *gin.Context) {
 // APIGetCollationCharSet returns the character sets and collation available in
 // database
 func APIGetCollationCharSet(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	res, err := dbClient.DatabaseCollationCharSet()
 	if err != nil {
@@ -360,9 +409,7 @@ func APIGetCollationCharSet(c *gin.Context) {
 
 // APIAlterDatabase alter database to change charset & collation
 func APIAlterDatabase(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	res, err := dbClient.AlterDatabase(c.Params.ByName("database"),
 		c.Request.FormValue("charset"), c.Request.FormValue("collation"))
@@ -376,9 +423,7 @@ func APIAlterDatabase(c *gin.Context) {
 
 // APIDropDatabase drops the given database from the system
 func APIDropDatabase(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	_, err := dbClient.DropDatabase(c.Params.ByName("database"))
 	if err != nil {
@@ -391,9 +436,7 @@ func APIDropDatabase(c *gin.Context) {
 
 // APIDropTable will drop the table from this database
 func APIDropTable(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	_, err := dbClient.DropTable(c.Params.ByName("database"), c.Params.ByName("table"))
 	if err != nil {
@@ -406,9 +449,7 @@ func APIDropTable(c *gin.Context) {
 
 // APITruncateTable truncates the table
 func APITruncateTable(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	_, err := dbClient.TruncateTable(c.Params.ByName("database"), c.Params.ByName("table"))
 	if err != nil {
@@ -421,9 +462,7 @@ func APITruncateTable(c *gin.Context) {
 
 // APIProcedureDefinition get definition of a procedure
 func APIProcedureDefinition(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	res, err := dbClient.ProcedureDefinition("procedure", c.Params.ByName("database"), c.Params.ByName("procedure"))
 	if err != nil {
@@ -436,9 +475,7 @@ func APIProcedureDefinition(c *gin.Context) {
 
 // APIFunctionDefinition get definition of a function
 func APIFunctionDefinition(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	res, err := dbClient.ProcedureDefinition("function", c.Params.ByName("database"), c.Params.ByName("function"))
 	if err != nil {
@@ -451,9 +488,7 @@ func APIFunctionDefinition(c *gin.Context) {
 
 // APICreateProcedure creates/edits a stored procedure
 func APICreateProcedure(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	dbName := c.Params.ByName("database")
 	procName := c.Params.ByName("procedure")
@@ -470,9 +505,7 @@ func APICreateProcedure(c *gin.Context) {
 
 // APICreateFunction creates/edits a function
 func APICreateFunction(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	dbName := c.Params.ByName("database")
 	procName := c.Params.ByName("function")
@@ -489,9 +522,7 @@ func APICreateFunction(c *gin.Context) {
 
 // APIDropProcedure drops the procedure
 func APIDropProcedure(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	_, err := dbClient.DropProcedure("PROCEDURE", c.Params.ByName("database"), c.Params.ByName("procedure"))
 	if err != nil {
@@ -504,9 +535,7 @@ func APIDropProcedure(c *gin.Context) {
 
 // APIViewDefinition gets the definition of a view
 func APIViewDefinition(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	res, err := dbClient.ViewDefinition(c.Params.ByName("database"), c.Params.ByName("view"))
 	if err != nil {
@@ -518,9 +547,7 @@ func APIViewDefinition(c *gin.Context) {
 }
 
 func apiSearch(c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
-	dbClient := dbClientMap[yoConnID]
+	dbClient := getClient(c)
 
 	res, err := dbClient.Search(c.Params.ByName("query"))
 	if err != nil {
@@ -531,51 +558,210 @@ func apiSearch(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 
-// APIHandleQuery handles thq query and return the resultset as JSON
-func APIHandleQuery(query string, c *gin.Context) {
-	// Read client id from the headers
-	yoConnID := c.Request.Header.Get("X-CONN-ID")
+// APIHandleQuery handles the query and returns the resultset as JSON, or as
+// a file download in the requested format (csv, tsv, json, ndjson, markdown
+// or sql, the latter requiring a table parameter). args are bound to the ?
+// placeholders of the query.
+func APIHandleQuery(query string, c *gin.Context, args ...interface{}) {
+	dbClient := getClient(c)
+
+	if err := dbClient.checkReadOnly(query); err != nil {
+		c.JSON(http.StatusForbidden, NewError(err))
+		return
+	}
 
-	// If id missing from header, check in query string
-	if yoConnID == "" {
-		yoConnID = c.Request.FormValue("conn_id")
+	// Make it mandatory to have WHERE for UPDATE & DELETE, depending on the
+	// connection policy
+	warning, err := dbClient.checkSafeUpdate(query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
 	}
 
-	if yoConnID == "" {
-		c.JSON(http.StatusBadRequest, Error{"Invalid connection"})
+	jsonWriter := newJSONRowWriter(c.Writer)
+	var writer RowWriter = jsonWriter
+
+	if warning != "" {
+		c.Header("X-Warning", warning)
+		jsonWriter.warnings = append(jsonWriter.warnings, warning)
+	}
+
+	if format := c.Query("format"); format != "" {
+		opts, err := parseExportOptions(format, c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, NewError(err))
+			return
+		}
+
+		exportWriter, err := newExportRowWriter(c.Writer, format, opts)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, NewError(err))
+			return
+		}
+		writer = exportWriter
+	}
+
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	queryID, err := requestQueryID(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, NewError(err))
 		return
 	}
 
-	dbClient := dbClientMap[yoConnID]
+	// Rows are written to the response as they are read, so errors can
+	// only be reported with a proper status if nothing was sent yet
+	err = dbClient.Stream(ctx, queryID, query, options.MaxRows, writer, args...)
+	if err != nil && !c.Writer.Written() {
+		c.JSON(http.StatusBadRequest, NewError(err))
+	}
+}
+
+// Settings of a connection
+type Settings struct {
+	SafeUpdates string `json:"safe_updates"`
+	ReadOnly    bool   `json:"read_only"`
+}
+
+// APIGetSettings returns the settings of the connection
+func APIGetSettings(c *gin.Context) {
+	dbClient := getClient(c)
+
+	c.JSON(http.StatusOK, Settings{
+		SafeUpdates: dbClient.SafeUpdates(),
+		ReadOnly:    dbClient.ReadOnly(),
+	})
+}
 
-	// 31 Aug
-	// Make it mandatory to have WHERE for UPDATE & DELETE
-	// TODO: Make this enforcing a setting
+// APISaveSettings changes the settings of the connection
+func APISaveSettings(c *gin.Context) {
+	dbClient := getClient(c)
 
-	if strings.Contains(strings.ToUpper(query), "UPDATE") ||
-		strings.Contains(strings.ToUpper(query), "DELETE") {
-		if !strings.Contains(strings.ToUpper(query), "WHERE") {
-			c.JSON(http.StatusBadRequest, Error{"WHERE statement is mandatory with UPDATE & DELETE statements"})
+	if policy := c.Request.FormValue("safe_updates"); policy != "" {
+		if err := dbClient.SetSafeUpdates(policy); err != nil {
+			c.JSON(http.StatusBadRequest, NewError(err))
 			return
 		}
 	}
 
-	result, err := dbClient.Query(query)
+	APIGetSettings(c)
+}
+
+// APIBeginTransaction opens a transaction on the connection
+func APIBeginTransaction(c *gin.Context) {
+	handleTransaction(c, getClient(c).Begin)
+}
+
+// APICommitTransaction commits the open transaction
+func APICommitTransaction(c *gin.Context) {
+	handleTransaction(c, getClient(c).Commit)
+}
+
+// APIRollbackTransaction rolls back the open transaction
+func APIRollbackTransaction(c *gin.Context) {
+	handleTransaction(c, getClient(c).Rollback)
+}
+
+func handleTransaction(c *gin.Context, action func(ctx context.Context) error) {
+	err := action(c.Request.Context())
+	if err == ErrTransactionOpen || err == ErrNoTransaction || err == ErrTransactionLost {
+		c.JSON(http.StatusConflict, NewError(err))
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, NewError(err))
 		return
 	}
 
-	q := c.Request.URL.Query()
+	c.JSON(http.StatusOK, getClient(c).Transaction())
+}
+
+// APIRunScript runs a script made of several statements and returns the
+// result of each one
+func APIRunScript(c *gin.Context) {
+	dbClient := getClient(c)
 
-	if len(q["format"]) > 0 {
-		if q["format"][0] == "csv" {
-			c.Data(http.StatusOK, "text/csv", result.CSV())
+	script := c.Request.FormValue("script")
+	if strings.TrimSpace(script) == "" {
+		c.JSON(http.StatusBadRequest, Error{"Script parameter is missing"})
+		return
+	}
+
+	stopOnError := true
+	if value := c.Request.FormValue("stop_on_error"); value != "" {
+		var err error
+		stopOnError, err = strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, NewError(err))
 			return
 		}
 	}
 
-	c.JSON(http.StatusOK, result)
+	statements, err := splitStatements(script)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	queryID, err := requestQueryID(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, NewError(err))
+		return
+	}
+
+	results, err := dbClient.RunScript(ctx, queryID, statements, options.MaxRows, stopOnError)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// queryContext returns the context user queries run under, which ends with
+// the request or once the query timeout is reached
+func queryContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	if options.QueryTimeout > 0 {
+		return context.WithTimeout(c.Request.Context(), options.QueryTimeout)
+	}
+
+	return context.WithCancel(c.Request.Context())
+}
+
+// requestQueryID returns the id the query of the request runs under, which
+// lets the UI cancel it while it is running. One is generated if the
+// request doesn't provide it.
+func requestQueryID(c *gin.Context) (string, error) {
+	queryID := c.Request.FormValue("query_id")
+
+	if queryID == "" {
+		u4, err := uuid.NewV4()
+		if err != nil {
+			return "", err
+		}
+		queryID = u4.String()
+	}
+
+	c.Header("X-Query-ID", queryID)
+
+	return queryID, nil
+}
+
+// APICancelQuery cancels a running query of the connection
+func APICancelQuery(c *gin.Context) {
+	dbClient := getClient(c)
+
+	err := dbClient.CancelQuery(c.Params.ByName("id"))
+	if err == ErrQueryNotFound {
+		c.JSON(http.StatusNotFound, NewError(err))
+		return
+	}
+
+	c.Writer.WriteHeader(http.StatusNoContent)
 }
 
 func APIGetBookmarks(c *gin.Context) {
@@ -585,10 +771,25 @@ func APIGetBookmarks(c *gin.Context) {
 		return
 	}
 
+	for i, bookmark := range bookmarks.Bookmarks {
+		bookmarks.Bookmarks[i] = bookmark.redacted()
+	}
+
 	c.JSON(http.StatusOK, bookmarks)
 }
 
+// APISaveBookmark creates a bookmark
 func APISaveBookmark(c *gin.Context) {
+	apiSaveBookmark(c, true)
+}
+
+// APIUpdateBookmark replaces the settings of a bookmark. The saved password
+// is kept unless a new one is given or clear_password is set.
+func APIUpdateBookmark(c *gin.Context) {
+	apiSaveBookmark(c, false)
+}
+
+func apiSaveBookmark(c *gin.Context, create bool) {
 	bookName := c.Params.ByName("name")
 
 	conHost := c.Request.FormValue("host")
@@ -600,33 +801,131 @@ func APISaveBookmark(c *gin.Context) {
 	}
 	conUser := c.Request.FormValue("user")
 	conDatabase := c.Request.FormValue("database")
+	conReadOnly, _ := strconv.ParseBool(c.Request.FormValue("readonly"))
 
 	objBookmark := Bookmark{
 		Name: bookName,
-		Connection: Connection{
-			Host:     conHost,
-			Port:     intConPort,
-			Username: conUser,
-			Database: conDatabase,
+		Connection: BookmarkConnection{
+			Connection: Connection{
+				Host:     conHost,
+				Port:     intConPort,
+				Username: conUser,
+				Database: conDatabase,
+				ReadOnly: conReadOnly,
+			},
+			Charset:        c.Request.FormValue("charset"),
+			TLSMode:        c.Request.FormValue("tls"),
+			TLSCA:          c.Request.FormValue("tls_ca"),
+			TLSCert:        c.Request.FormValue("tls_cert"),
+			TLSKey:         c.Request.FormValue("tls_key"),
+			ConnectTimeout: c.Request.FormValue("timeout"),
+			ReadTimeout:    c.Request.FormValue("read_timeout"),
+			WriteTimeout:   c.Request.FormValue("write_timeout"),
 		},
 	}
 
-	i, err := saveBookmark(objBookmark, getBookmarkPath())
+	if err := objBookmark.Connection.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
 
-	if i == -1 {
-		c.JSON(http.StatusBadRequest, NewError(errors.New("A connection with this name already exists")))
+	if password := c.Request.FormValue("password"); password != "" {
+		key, err := secretKey()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, NewError(err))
+			return
+		}
+
+		objBookmark.Connection.Password, err = encryptSecret(key, password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, NewError(err))
+			return
+		}
+	} else if clear, _ := strconv.ParseBool(c.Request.FormValue("clear_password")); !create && !clear {
+		existing, err := readBookmark(bookName, getBookmarkPath())
+		if err != nil {
+			c.JSON(bookmarkStatus(err), NewError(err))
+			return
+		}
+
+		objBookmark.Connection.Password = existing.Connection.Password
+	}
+
+	err = saveBookmark(objBookmark, getBookmarkPath(), create)
+	if err != nil {
+		c.JSON(bookmarkStatus(err), NewError(err))
+		return
+	}
+
+	c.Writer.WriteHeader(http.StatusNoContent)
+}
+
+// APIRenameBookmark moves a bookmark to the name given in the name form
+// value
+func APIRenameBookmark(c *gin.Context) {
+	err := renameBookmark(c.Params.ByName("name"), c.Request.FormValue("name"), getBookmarkPath())
+	if err != nil {
+		c.JSON(bookmarkStatus(err), NewError(err))
 		return
 	}
 
 	c.Writer.WriteHeader(http.StatusNoContent)
 }
 
+// APIConnectBookmark opens a connection with the settings of a bookmark,
+// responding like APIConnect
+func APIConnectBookmark(c *gin.Context) {
+	bookmark, err := readBookmark(c.Params.ByName("name"), getBookmarkPath())
+	if err != nil {
+		c.JSON(bookmarkStatus(err), NewError(err))
+		return
+	}
+
+	conn := bookmark.Connection
+
+	password := ""
+	if conn.Password != "" {
+		key, err := secretKey()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, NewError(err))
+			return
+		}
+
+		password, err = decryptSecret(key, conn.Password)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, NewError(err))
+			return
+		}
+	}
+
+	cfg, err := conn.config(password)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	client, err := NewClientFromConfig(cfg)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+	client.readOnly = options.ReadOnly || conn.ReadOnly
+
+	registerClient(c, client, Connection{
+		Host:     conn.Host,
+		Port:     conn.Port,
+		Username: conn.Username,
+		Database: conn.Database,
+		ReadOnly: client.readOnly,
+	})
+}
+
 func APIDeleteBookmark(c *gin.Context) {
 	bookName := c.Params.ByName("name")
 
 	err := deleteBookmark(bookName, getBookmarkPath())
 	if err != nil {
-		c.JSON(http.StatusBadRequest, NewError(err))
+		c.JSON(bookmarkStatus(err), NewError(err))
 		return
 	}
 
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// ErrNoPrimaryKey is returned when a row can't be addressed as its table
+	// has no primary key
+	ErrNoPrimaryKey = errors.New("Table has no primary key")
+
+	// ErrRowNotFound is returned when no row matches the given key
+	ErrRowNotFound = errors.New("Row not found")
+
+	// ErrNullCell is returned when reading the content of a NULL cell
+	ErrNullCell = errors.New("Cell is NULL")
+)
+
+// blobChunkSize is the number of bytes, or characters for text columns, of
+// a cell read at once
+const blobChunkSize = 1 << 20
+
+// TablePrimaryKey returns the columns of the primary key of the table, in
+// index order
+func (client *Client) TablePrimaryKey(database string, table string) ([]string, error) {
+	res, err := client.Query(MySQLTablePrimaryKey, database, table)
+	if err != nil {
+		return nil, err
+	}
+
+	var columns []string
+	for _, row := range res.Rows {
+		columns = append(columns, fmt.Sprint(row[0]))
+	}
+
+	return columns, nil
+}
+
+// keyCondition builds the WHERE condition matching the row identified by
+// key, with one ? placeholder per column, and the arguments to bind. key
+// must hold a value for each column of the primary key and nothing else.
+func keyCondition(primaryKey []string, key map[string]string) (string, []interface{}, error) {
+	if len(primaryKey) == 0 {
+		return "", nil, ErrNoPrimaryKey
+	}
+
+	if len(key) != len(primaryKey) {
+		return "", nil, fmt.Errorf("Key must hold exactly the primary key columns: %s", strings.Join(primaryKey, ", "))
+	}
+
+	conditions := make([]string, len(primaryKey))
+	args := make([]interface{}, len(primaryKey))
+
+	for i, column := range primaryKey {
+		value, ok := key[column]
+		if !ok {
+			return "", nil, fmt.Errorf("Missing value for primary key column %s", column)
+		}
+
+		conditions[i] = quoteIdentifier(column) + " = ?"
+		args[i] = value
+	}
+
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// Blob streams the raw content of a single cell to the writer returned by
+// open, the row being identified by the values of its primary key. The cell
+// is read by chunks of blobChunkSize in a read only transaction, so a large
+// value is never held in memory and its chunks are consistent. open is
+// called once with the first chunk, e.g. to detect the content type, before
+// anything is written.
+func (client *Client) Blob(ctx context.Context, database string, table string, column string, key map[string]string, open func(head []byte) io.Writer) error {
+	primaryKey, err := client.TablePrimaryKey(database, table)
+	if err != nil {
+		return err
+	}
+
+	condition, args, err := keyCondition(primaryKey, key)
+	if err != nil {
+		return err
+	}
+
+	name := qualifiedName(database, table)
+	query := fmt.Sprintf(MySQLSelectCellChunk, quoteIdentifier(column), name, condition)
+
+	entry := Query{Query: query, Origin: OriginInternal}
+	start := time.Now()
+
+	err = client.streamCell(ctx, fmt.Sprintf(MySQLCellLength, quoteIdentifier(column), name, condition), query, args, open)
+	if err == ErrRowNotFound || err == ErrNullCell {
+		client.recordExecution(entry, start, nil)
+		return err
+	}
+
+	if err == nil {
+		entry.RowsReturned = 1
+	}
+	client.recordExecution(entry, start, err)
+
+	return err
+}
+
+// streamCell writes the cell selected by the queries, lengthQuery returning
+// its length and chunkQuery a part of it
+func (client *Client) streamCell(ctx context.Context, lengthQuery string, chunkQuery string, args []interface{}, open func(head []byte) io.Writer) error {
+	tx, err := client.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var length sql.NullInt64
+	err = tx.QueryRowContext(ctx, lengthQuery, args...).Scan(&length)
+	if err == sql.ErrNoRows {
+		return ErrRowNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !length.Valid {
+		return ErrNullCell
+	}
+
+	var w io.Writer
+
+	// SUBSTRING positions start at 1
+	for position := int64(1); position <= length.Int64 || w == nil; position += blobChunkSize {
+		var chunk []byte
+		if length.Int64 > 0 {
+			chunkArgs := append([]interface{}{position, blobChunkSize}, args...)
+			if err := tx.QueryRowContext(ctx, chunkQuery, chunkArgs...).Scan(&chunk); err != nil {
+				return err
+			}
+		}
+
+		if w == nil {
+			w = open(chunk)
+		}
+
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// blobFilename names a downloaded cell after its table, column and key, with
+// the extension of the content type when known
+func blobFilename(table string, column string, key map[string]string, contentType string) string {
+	names := make([]string, 0, len(key))
+	for name := range key {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := []string{table, column}
+	for _, name := range names {
+		parts = append(parts, key[name])
+	}
+
+	name := safeFilename(strings.Join(parts, "-"))
+
+	if extensions, err := mime.ExtensionsByType(contentType); err == nil && len(extensions) > 0 {
+		name += extensions[0]
+	}
+
+	return name
+}
+
+// APIGetBlob streams the raw content of a cell, e.g. a stored image or file.
+// The column is given in the column parameter and the row by its primary key,
+// as key[name]=value parameters.
+func APIGetBlob(c *gin.Context) {
+	dbClient := getClient(c)
+
+	database := c.Params.ByName("database")
+	table := c.Params.ByName("table")
+	column := c.Query("column")
+	key := c.QueryMap("key")
+
+	if column == "" {
+		c.JSON(http.StatusBadRequest, Error{"Column parameter is required"})
+		return
+	}
+
+	err := dbClient.Blob(c.Request.Context(), database, table, column, key, func(head []byte) io.Writer {
+		contentType := http.DetectContentType(head)
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		filename := blobFilename(table, column, key, mediaType)
+
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		c.Status(http.StatusOK)
+
+		return c.Writer
+	})
+
+	switch {
+	case err == ErrRowNotFound:
+		c.JSON(http.StatusNotFound, NewError(err))
+	case err == ErrNullCell:
+		c.Writer.WriteHeader(http.StatusNoContent)
+	case err != nil && !c.Writer.Written():
+		// Once the content is being sent, the download can only be cut
+		c.JSON(http.StatusBadRequest, NewError(err))
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyCondition(t *testing.T) {
+	condition, args, err := keyCondition([]string{"id", "lang"}, map[string]string{"id": "5", "lang": "en"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "`id` = ? AND `lang` = ?", condition)
+	assert.Equal(t, []interface{}{"5", "en"}, args)
+}
+
+func TestKeyCondition_Invalid(t *testing.T) {
+	_, _, err := keyCondition(nil, map[string]string{"id": "5"})
+	assert.Equal(t, ErrNoPrimaryKey, err)
+
+	_, _, err = keyCondition([]string{"id", "lang"}, map[string]string{"id": "5"})
+	assert.Error(t, err)
+
+	_, _, err = keyCondition([]string{"id"}, map[string]string{"name": "x"})
+	assert.Error(t, err)
+}
+
+func TestBlobFilename(t *testing.T) {
+	name := blobFilename("users", "avatar", map[string]string{"id": "5", "a": "x/y"}, "image/png")
+
+	assert.Equal(t, "users-avatar-x_y-5.png", name)
+}
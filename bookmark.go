@@ -1,16 +1,43 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/mitchellh/go-homedir"
 )
 
+// TLS modes of the bookmarks, named after the ssl-mode option of the mysql
+// client
+const (
+	TLSDisabled       = "disabled"
+	TLSPreferred      = "preferred"
+	TLSRequired       = "required"
+	TLSVerifyCA       = "verify-ca"
+	TLSVerifyIdentity = "verify-identity"
+)
+
+var (
+	// ErrBookmarkNotFound is returned when no bookmark has the given name
+	ErrBookmarkNotFound = errors.New("Bookmark not found")
+
+	// ErrBookmarkExists is returned when saving a bookmark under a name
+	// already taken
+	ErrBookmarkExists = errors.New("A connection with this name already exists")
+)
+
 // Connection is a single saved connection-string object
 type Connection struct {
 	Host     string
@@ -18,11 +45,36 @@ type Connection struct {
 	Username string
 	Database string
 	ConnID   string
+	ReadOnly bool
 }
 
+// BookmarkConnection holds the settings of a saved connection. The password
+// is kept encrypted, see encryptSecret, and timeouts are duration strings
+// such as "10s".
+type BookmarkConnection struct {
+	Connection
+
+	Password       string `json:",omitempty"`
+	Charset        string `json:",omitempty"`
+	TLSMode        string `json:",omitempty"`
+	TLSCA          string `json:",omitempty"`
+	TLSCert        string `json:",omitempty"`
+	TLSKey         string `json:",omitempty"`
+	ConnectTimeout string `json:",omitempty"`
+	ReadTimeout    string `json:",omitempty"`
+	WriteTimeout   string `json:",omitempty"`
+
+	// HasPassword replaces the password in the API responses, it is never
+	// stored
+	HasPassword bool `json:",omitempty"`
+}
+
+// Bookmark is a saved connection. Error tells why the file of a listed
+// bookmark can't be read, its connection being empty then.
 type Bookmark struct {
-	Name       string     `json:"name"`
-	Connection Connection `json:"conn_info"`
+	Name       string             `json:"name"`
+	Connection BookmarkConnection `json:"conn_info"`
+	Error      string             `json:"error,omitempty"`
 }
 
 type Bookmarks struct {
@@ -49,6 +101,22 @@ func getBookmarkPath() string {
 	return bookmarkPath
 }
 
+func validateBookmarkName(name string) error {
+	if !validSavedName(name) {
+		return fmt.Errorf("Invalid bookmark name %q: use letters, digits, spaces, dots, dashes and underscores", name)
+	}
+
+	return nil
+}
+
+// bookmarkFile returns the path of the file of the bookmark, the name must
+// be valid
+func bookmarkFile(name string, path string) string {
+	return filepath.Join(path, name+".json")
+}
+
+// readBookmarks lists the bookmarks of the directory. The ones which can't
+// be decoded are listed with their error, so they can be fixed or deleted.
 func readBookmarks(path string) (Bookmarks, error) {
 	results := Bookmarks{
 		Bookmarks: []Bookmark{},
@@ -60,68 +128,286 @@ func readBookmarks(path string) (Bookmarks, error) {
 	}
 
 	for _, file := range files {
-		// We need .json files only
-		if filepath.Ext(file.Name()) != ".json" {
+		// We need .json files only, temporary files of a write in progress
+		// are hidden
+		if filepath.Ext(file.Name()) != ".json" || strings.HasPrefix(file.Name(), ".") {
 			continue
 		}
 
-		fullpath := filepath.FromSlash(path + "/" + file.Name())
-		conName := fileBaseName(file.Name())
-
-		data, err := ioutil.ReadFile(fullpath)
+		thisBookmark, err := readBookmark(fileBaseName(file.Name()), path)
+		if err == ErrBookmarkNotFound {
+			// Deleted meanwhile, or named outside of the rules
+			continue
+		}
 		if err != nil {
-			return results, err
+			thisBookmark = Bookmark{
+				Name:  fileBaseName(file.Name()),
+				Error: err.Error(),
+			}
 		}
 
-		thisConn := Connection{}
+		results.Bookmarks = append(results.Bookmarks, thisBookmark)
+	}
 
-		json.Unmarshal(data, &thisConn)
+	return results, nil
+}
 
-		thisBookmark := Bookmark{
-			Name:       conName,
-			Connection: thisConn,
-		}
+// readBookmark returns the bookmark saved under name
+func readBookmark(name string, path string) (Bookmark, error) {
+	if validateBookmarkName(name) != nil {
+		return Bookmark{}, ErrBookmarkNotFound
+	}
 
-		results.Bookmarks = append(results.Bookmarks, thisBookmark)
+	data, err := ioutil.ReadFile(bookmarkFile(name, path))
+	if os.IsNotExist(err) {
+		return Bookmark{}, ErrBookmarkNotFound
+	}
+	if err != nil {
+		return Bookmark{}, err
+	}
 
+	bookmark := Bookmark{Name: name}
+	if err := json.Unmarshal(data, &bookmark.Connection); err != nil {
+		return Bookmark{}, fmt.Errorf("Bookmark %s is corrupt: %s", name, err)
 	}
 
-	return results, nil
+	return bookmark, nil
 }
 
-func saveBookmark(objBookmark Bookmark, path string) (int, error) {
-	fileName := objBookmark.Name + ".json"
-
-	data, jerr := json.MarshalIndent(objBookmark.Connection, "", "  ")
-	if jerr != nil {
-		return 0, jerr
+// saveBookmark writes the bookmark, creating it or replacing an existing
+// one. The file is replaced atomically, so it is never left half written.
+func saveBookmark(objBookmark Bookmark, path string, create bool) error {
+	if err := validateBookmarkName(objBookmark.Name); err != nil {
+		return err
 	}
 
-	fullFilePath := filepath.FromSlash(path + "/" + fileName)
+	objBookmark.Connection.HasPassword = false
 
-	// equivalent to Python's `if not os.path.exists(filename)`
-	if _, err := os.Stat(fullFilePath); err == nil {
-		// fmt.Printf("file exists; processing...")
-		return -1, nil
+	data, err := json.MarshalIndent(objBookmark.Connection, "", "  ")
+	if err != nil {
+		return err
 	}
 
-	filErr := ioutil.WriteFile(fullFilePath, data, 0o644)
-	if filErr != nil {
-		return 0, filErr
+	fullFilePath := bookmarkFile(objBookmark.Name, path)
+
+	_, err = os.Stat(fullFilePath)
+	switch {
+	case err == nil && create:
+		return ErrBookmarkExists
+	case os.IsNotExist(err) && !create:
+		return ErrBookmarkNotFound
+	case err != nil && !os.IsNotExist(err):
+		return err
 	}
 
-	return 1, nil
+	// The file may hold a password, even encrypted it is kept private
+	return writeFileAtomic(fullFilePath, data, 0o600)
 }
 
-func deleteBookmark(bookmarkName string, path string) error {
-	fileName := bookmarkName + ".json"
+// renameBookmark moves the bookmark to a new name, which must be free
+func renameBookmark(oldName string, newName string, path string) error {
+	if validateBookmarkName(oldName) != nil {
+		return ErrBookmarkNotFound
+	}
+	if err := validateBookmarkName(newName); err != nil {
+		return err
+	}
 
-	fullFilePath := filepath.FromSlash(path + "/" + fileName)
+	oldPath := bookmarkFile(oldName, path)
+	newPath := bookmarkFile(newName, path)
 
-	err := os.Remove(fullFilePath)
+	oldInfo, err := os.Stat(oldPath)
+	if os.IsNotExist(err) {
+		return ErrBookmarkNotFound
+	}
 	if err != nil {
 		return err
 	}
 
+	// On case insensitive file systems a change of case finds the same file
+	if newInfo, err := os.Stat(newPath); err == nil && !os.SameFile(oldInfo, newInfo) {
+		return ErrBookmarkExists
+	}
+
+	return os.Rename(oldPath, newPath)
+}
+
+func deleteBookmark(bookmarkName string, path string) error {
+	if validateBookmarkName(bookmarkName) != nil {
+		return ErrBookmarkNotFound
+	}
+
+	err := os.Remove(bookmarkFile(bookmarkName, path))
+	if os.IsNotExist(err) {
+		return ErrBookmarkNotFound
+	}
+
+	return err
+}
+
+// bookmarkStatus returns the HTTP status reporting err
+func bookmarkStatus(err error) int {
+	switch err {
+	case ErrBookmarkNotFound:
+		return http.StatusNotFound
+	case ErrBookmarkExists:
+		return http.StatusConflict
+	}
+
+	return http.StatusBadRequest
+}
+
+// redacted returns the bookmark without its password, for the API responses
+func (b Bookmark) redacted() Bookmark {
+	b.Connection.HasPassword = b.Connection.Password != ""
+	b.Connection.Password = ""
+	return b
+}
+
+// validate checks the settings of the connection, except the files which
+// are only read when connecting
+func (conn BookmarkConnection) validate() error {
+	switch conn.TLSMode {
+	case "", TLSDisabled, TLSPreferred, TLSRequired, TLSVerifyCA, TLSVerifyIdentity:
+	default:
+		return fmt.Errorf("Invalid TLS mode %q, expected disabled, preferred, required, verify-ca or verify-identity", conn.TLSMode)
+	}
+
+	if (conn.TLSCert == "") != (conn.TLSKey == "") {
+		return errors.New("TLS certificate and key must be given together")
+	}
+
+	if conn.Charset != "" {
+		if err := validateCharsetName(conn.Charset); err != nil {
+			return err
+		}
+	}
+
+	for _, timeout := range []string{conn.ConnectTimeout, conn.ReadTimeout, conn.WriteTimeout} {
+		if _, err := parseTimeout(timeout); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+// config returns the driver configuration of the connection, with the
+// given decrypted password
+func (conn BookmarkConnection) config(password string) (*mysql.Config, error) {
+	if err := conn.validate(); err != nil {
+		return nil, err
+	}
+
+	cfg := mysql.NewConfig()
+	cfg.User = conn.Username
+	cfg.Passwd = password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(conn.Host, strconv.Itoa(conn.Port))
+	cfg.DBName = conn.Database
+
+	if conn.Charset != "" {
+		cfg.Params = map[string]string{"charset": conn.Charset}
+	}
+
+	// Validated above
+	cfg.Timeout, _ = parseTimeout(conn.ConnectTimeout)
+	cfg.ReadTimeout, _ = parseTimeout(conn.ReadTimeout)
+	cfg.WriteTimeout, _ = parseTimeout(conn.WriteTimeout)
+
+	tlsConfig, err := conn.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.TLS = tlsConfig
+	cfg.AllowFallbackToPlaintext = conn.TLSMode == TLSPreferred
+
+	return cfg, nil
+}
+
+// tlsConfig returns the TLS configuration matching the mode, nil when TLS
+// is disabled. As with the mysql client, the preferred and required modes
+// encrypt the connection without verifying the server certificate.
+func (conn BookmarkConnection) tlsConfig() (*tls.Config, error) {
+	if conn.TLSMode == "" || conn.TLSMode == TLSDisabled {
+		return nil, nil
+	}
+
+	config := &tls.Config{ServerName: conn.Host}
+
+	if conn.TLSCA != "" {
+		pem, err := ioutil.ReadFile(conn.TLSCA)
+		if err != nil {
+			return nil, err
+		}
+
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificate found in %s", conn.TLSCA)
+		}
+	}
+
+	if conn.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(conn.TLSCert, conn.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	switch conn.TLSMode {
+	case TLSPreferred, TLSRequired:
+		config.InsecureSkipVerify = true
+	case TLSVerifyCA:
+		// The chain is verified but not the host name
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyChain(rawCerts, config.RootCAs)
+		}
+	}
+
+	return config, nil
+}
+
+// verifyChain checks that the certificates sent by the server are signed by
+// one of roots, or by the system authorities when roots is nil
+func verifyChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+
+	if len(certs) == 0 {
+		return errors.New("Server sent no certificate")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(opts)
+	return err
+}
+
+func parseTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("Invalid timeout %q", value)
+	}
+
+	return timeout, nil
+}
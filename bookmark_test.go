@@ -0,0 +1,255 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mitchellh/go-homedir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretEncryption(t *testing.T) {
+	key := deriveKey("master")
+
+	sealed, err := encryptSecret(key, "s3cr3t:@/")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sealed, secretPrefix))
+	assert.NotContains(t, sealed, "s3cr3t")
+
+	// Every encryption uses its own nonce
+	other, _ := encryptSecret(key, "s3cr3t:@/")
+	assert.NotEqual(t, sealed, other)
+
+	plain, err := decryptSecret(key, sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t:@/", plain)
+
+	_, err = decryptSecret(deriveKey("other"), sealed)
+	assert.Equal(t, ErrSecretKey, err)
+
+	_, err = decryptSecret(key, "s3cr3t")
+	assert.EqualError(t, err, "Value is not encrypted")
+}
+
+func TestReadKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bookmark.key")
+
+	key, err := readKeyFile(path)
+	assert.NoError(t, err)
+	assert.Len(t, key, 32)
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	again, err := readKeyFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, key, again)
+}
+
+func TestBookmarkConnectionConfig(t *testing.T) {
+	conn := BookmarkConnection{
+		Connection: Connection{
+			Host:     "db.example.com",
+			Port:     3307,
+			Username: "app",
+			Database: "shop",
+		},
+		Charset:        "utf8mb4",
+		TLSMode:        TLSVerifyIdentity,
+		ConnectTimeout: "5s",
+		ReadTimeout:    "1m",
+	}
+
+	cfg, err := conn.config("p@ss:word")
+	assert.NoError(t, err)
+	assert.Equal(t, "app", cfg.User)
+	assert.Equal(t, "p@ss:word", cfg.Passwd)
+	assert.Equal(t, "db.example.com:3307", cfg.Addr)
+	assert.Equal(t, "shop", cfg.DBName)
+	assert.Equal(t, map[string]string{"charset": "utf8mb4"}, cfg.Params)
+	assert.Equal(t, 5*time.Second, cfg.Timeout)
+	assert.Equal(t, time.Minute, cfg.ReadTimeout)
+	assert.Equal(t, time.Duration(0), cfg.WriteTimeout)
+	assert.Equal(t, "db.example.com", cfg.TLS.ServerName)
+	assert.False(t, cfg.TLS.InsecureSkipVerify)
+	assert.False(t, cfg.AllowFallbackToPlaintext)
+
+	conn.TLSMode = TLSPreferred
+	cfg, err = conn.config("")
+	assert.NoError(t, err)
+	assert.True(t, cfg.TLS.InsecureSkipVerify)
+	assert.True(t, cfg.AllowFallbackToPlaintext)
+
+	conn.TLSMode = TLSDisabled
+	cfg, err = conn.config("")
+	assert.NoError(t, err)
+	assert.Nil(t, cfg.TLS)
+
+	conn.TLSMode = TLSVerifyCA
+	conn.TLSCA = filepath.Join(t.TempDir(), "missing.pem")
+	_, err = conn.config("")
+	assert.Error(t, err)
+}
+
+func TestBookmarkConnectionValidate(t *testing.T) {
+	assert.NoError(t, BookmarkConnection{}.validate())
+
+	assert.EqualError(t, BookmarkConnection{TLSMode: "always"}.validate(),
+		`Invalid TLS mode "always", expected disabled, preferred, required, verify-ca or verify-identity`)
+	assert.EqualError(t, BookmarkConnection{TLSCert: "client.pem"}.validate(),
+		"TLS certificate and key must be given together")
+	assert.EqualError(t, BookmarkConnection{Charset: "utf8; DROP"}.validate(), "Invalid character set or collation name")
+	assert.EqualError(t, BookmarkConnection{WriteTimeout: "soon"}.validate(), `Invalid timeout "soon"`)
+}
+
+func TestSaveBookmarkWithOptions(t *testing.T) {
+	dir := t.TempDir()
+
+	bookmark := Bookmark{
+		Name: "prod",
+		Connection: BookmarkConnection{
+			Connection: Connection{Host: "localhost", Port: 3306, Username: "root", ReadOnly: true},
+			Password:   "enc:v1:abc",
+			TLSMode:    TLSRequired,
+		},
+	}
+
+	assert.NoError(t, saveBookmark(bookmark, dir, true))
+
+	info, err := os.Stat(filepath.Join(dir, "prod.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	saved, err := readBookmark("prod", dir)
+	assert.NoError(t, err)
+	assert.Equal(t, bookmark, saved)
+
+	redacted := saved.redacted()
+	assert.Empty(t, redacted.Connection.Password)
+	assert.True(t, redacted.Connection.HasPassword)
+
+	_, err = readBookmark("missing", dir)
+	assert.Equal(t, ErrBookmarkNotFound, err)
+}
+
+func TestReadLegacyBookmark(t *testing.T) {
+	dir := t.TempDir()
+	data := `{"Host": "localhost", "Port": 3306, "Username": "root", "Database": "app", "ConnID": "", "ReadOnly": false}`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "old.json"), []byte(data), 0o644))
+
+	bookmark, err := readBookmark("old", dir)
+	assert.NoError(t, err)
+	assert.Equal(t, Connection{Host: "localhost", Port: 3306, Username: "root", Database: "app"}, bookmark.Connection.Connection)
+	assert.Empty(t, bookmark.Connection.TLSMode)
+}
+
+func TestBookmarkLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	bookmark := Bookmark{Name: "dev", Connection: BookmarkConnection{Connection: Connection{Host: "localhost", Port: 3306}}}
+
+	assert.Equal(t, ErrBookmarkNotFound, saveBookmark(bookmark, dir, false))
+	assert.NoError(t, saveBookmark(bookmark, dir, true))
+	assert.Equal(t, ErrBookmarkExists, saveBookmark(bookmark, dir, true))
+
+	bookmark.Connection.Port = 3307
+	assert.NoError(t, saveBookmark(bookmark, dir, false))
+
+	saved, err := readBookmark("dev", dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 3307, saved.Connection.Port)
+
+	assert.NoError(t, saveBookmark(Bookmark{Name: "staging"}, dir, true))
+	assert.Equal(t, ErrBookmarkExists, renameBookmark("dev", "staging", dir))
+	assert.Equal(t, ErrBookmarkNotFound, renameBookmark("missing", "other", dir))
+	assert.NoError(t, renameBookmark("dev", "Dev 2", dir))
+
+	_, err = readBookmark("dev", dir)
+	assert.Equal(t, ErrBookmarkNotFound, err)
+	saved, err = readBookmark("Dev 2", dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 3307, saved.Connection.Port)
+
+	assert.NoError(t, deleteBookmark("Dev 2", dir))
+	assert.Equal(t, ErrBookmarkNotFound, deleteBookmark("Dev 2", dir))
+
+	// No temporary file is left behind
+	files, _ := os.ReadDir(dir)
+	assert.Len(t, files, 1)
+}
+
+func TestBookmarkNames(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "bookmark")
+	assert.NoError(t, os.Mkdir(dir, 0o700))
+
+	for _, name := range []string{"../x", "..", ".hidden", "a/b", `a\b`, "", strings.Repeat("a", 65)} {
+		assert.Error(t, saveBookmark(Bookmark{Name: name}, dir, true), name)
+		assert.Error(t, renameBookmark("x", name, dir), name)
+
+		_, err := readBookmark(name, dir)
+		assert.Equal(t, ErrBookmarkNotFound, err, name)
+		assert.Equal(t, ErrBookmarkNotFound, deleteBookmark(name, dir), name)
+	}
+
+	files, _ := os.ReadDir(filepath.Dir(dir))
+	assert.Len(t, files, 1)
+}
+
+func TestReadCorruptBookmarks(t *testing.T) {
+	dir := t.TempDir()
+
+	assert.NoError(t, saveBookmark(Bookmark{Name: "good"}, dir, true))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{"Host": `), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ".good.json.123.tmp"), []byte(`{}`), 0o600))
+
+	bookmarks, err := readBookmarks(dir)
+	assert.NoError(t, err)
+	assert.Len(t, bookmarks.Bookmarks, 2)
+
+	assert.Equal(t, "broken", bookmarks.Bookmarks[0].Name)
+	assert.Equal(t, "Bookmark broken is corrupt: unexpected end of JSON input", bookmarks.Bookmarks[0].Error)
+	assert.Equal(t, "good", bookmarks.Bookmarks[1].Name)
+	assert.Empty(t, bookmarks.Bookmarks[1].Error)
+
+	_, err = readBookmark("broken", dir)
+	assert.EqualError(t, err, "Bookmark broken is corrupt: unexpected end of JSON input")
+}
+
+func TestBookmarkEndpointsStatus(t *testing.T) {
+	homedir.DisableCache = true
+	defer func() { homedir.DisableCache = false }()
+	t.Setenv("HOME", t.TempDir())
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/bookmarks/:name", APISaveBookmark)
+	router.PUT("/bookmarks/:name", APIUpdateBookmark)
+	router.POST("/bookmarks/:name/rename", APIRenameBookmark)
+
+	send := func(method string, path string, form url.Values) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	form := url.Values{"host": {"localhost"}, "port": {"3306"}, "user": {"root"}}
+
+	assert.Equal(t, http.StatusNotFound, send(http.MethodPut, "/bookmarks/dev", form))
+	assert.Equal(t, http.StatusNoContent, send(http.MethodPost, "/bookmarks/dev", form))
+	assert.Equal(t, http.StatusConflict, send(http.MethodPost, "/bookmarks/dev", form))
+	assert.Equal(t, http.StatusNoContent, send(http.MethodPut, "/bookmarks/dev", form))
+	assert.Equal(t, http.StatusNoContent, send(http.MethodPost, "/bookmarks/prod", form))
+	assert.Equal(t, http.StatusConflict, send(http.MethodPost, "/bookmarks/dev/rename", url.Values{"name": {"prod"}}))
+	assert.Equal(t, http.StatusNotFound, send(http.MethodPost, "/bookmarks/missing/rename", url.Values{"name": {"other"}}))
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/bookmarks/dev/rename", url.Values{"name": {"../x"}}))
+}
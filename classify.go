@@ -0,0 +1,530 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Token kinds produced by tokenize
+const (
+	tokenWord = iota
+	tokenNumber
+	tokenString
+	tokenIdentifier
+	tokenVariable
+	tokenSymbol
+)
+
+// Token is a single lexical element of a statement
+type Token struct {
+	Kind  int
+	Value string
+}
+
+// is reports whether the token is the given keyword or symbol
+func (t Token) is(value string) bool {
+	return (t.Kind == tokenWord || t.Kind == tokenSymbol) && strings.EqualFold(t.Value, value)
+}
+
+// Statement kinds returned by classifyStatement
+const (
+	KindOther       = "other"
+	KindRead        = "read"
+	KindWrite       = "write"
+	KindDDL         = "ddl"
+	KindTransaction = "transaction"
+	KindSession     = "session"
+)
+
+var statementKinds = map[string]string{
+	"SELECT":    KindRead,
+	"SHOW":      KindRead,
+	"DESCRIBE":  KindRead,
+	"DESC":      KindRead,
+	"EXPLAIN":   KindRead,
+	"HELP":      KindRead,
+	"TABLE":     KindRead,
+	"VALUES":    KindRead,
+	"INSERT":    KindWrite,
+	"UPDATE":    KindWrite,
+	"DELETE":    KindWrite,
+	"REPLACE":   KindWrite,
+	"LOAD":      KindWrite,
+	"CREATE":    KindDDL,
+	"ALTER":     KindDDL,
+	"DROP":      KindDDL,
+	"TRUNCATE":  KindDDL,
+	"RENAME":    KindDDL,
+	"GRANT":     KindDDL,
+	"REVOKE":    KindDDL,
+	"BEGIN":     KindTransaction,
+	"START":     KindTransaction,
+	"COMMIT":    KindTransaction,
+	"ROLLBACK":  KindTransaction,
+	"SAVEPOINT": KindTransaction,
+	"RELEASE":   KindTransaction,
+	"USE":       KindSession,
+	"SET":       KindSession,
+}
+
+// StatementInfo describes a statement as found by classifyStatement
+type StatementInfo struct {
+	// Type is the main keyword of the statement, e.g. SELECT or UPDATE
+	Type string
+	Kind string
+	// HasWhere reports whether an UPDATE/DELETE has a WHERE clause, and
+	// TrivialWhere whether that clause is always true (e.g. WHERE 1=1)
+	HasWhere     bool
+	TrivialWhere bool
+}
+
+// Writes reports whether the statement modifies data or schema
+func (info StatementInfo) Writes() bool {
+	return info.Kind == KindWrite || info.Kind == KindDDL
+}
+
+// UnsafeUpdate reports whether the statement is an UPDATE or DELETE that
+// affects every row of the table
+func (info StatementInfo) UnsafeUpdate() bool {
+	if info.Type != "UPDATE" && info.Type != "DELETE" {
+		return false
+	}
+
+	return !info.HasWhere || info.TrivialWhere
+}
+
+// classifyStatement finds the type of a statement and, for UPDATE & DELETE,
+// inspects its WHERE clause
+func classifyStatement(sql string) StatementInfo {
+	tokens := tokenize(sql)
+	info := StatementInfo{Kind: KindOther}
+
+	// Skip opening parenthesis of e.g. (SELECT ...) UNION (SELECT ...)
+	start := 0
+	for start < len(tokens) && tokens[start].is("(") {
+		start++
+	}
+
+	if start == len(tokens) || tokens[start].Kind != tokenWord {
+		return info
+	}
+
+	info.Type = strings.ToUpper(tokens[start].Value)
+	body := tokens[start+1:]
+
+	// Common table expressions precede the actual statement
+	if info.Type == "WITH" {
+		info.Type = "SELECT"
+
+		for i, depth := 0, 0; i < len(body); i++ {
+			token := body[i]
+
+			if token.is("(") {
+				depth++
+			} else if token.is(")") {
+				depth--
+			} else if depth == 0 && token.Kind == tokenWord {
+				keyword := strings.ToUpper(token.Value)
+				if keyword == "SELECT" || keyword == "UPDATE" || keyword == "DELETE" || keyword == "INSERT" || keyword == "REPLACE" || keyword == "TABLE" || keyword == "VALUES" {
+					info.Type = keyword
+					body = body[i+1:]
+					break
+				}
+			}
+		}
+	}
+
+	if kind, ok := statementKinds[info.Type]; ok {
+		info.Kind = kind
+	}
+
+	if info.Type == "UPDATE" || info.Type == "DELETE" {
+		where := topLevelClause(body, "WHERE", "ORDER", "LIMIT")
+		info.HasWhere = where != nil
+		info.TrivialWhere = where != nil && alwaysTrue(where)
+	}
+
+	return info
+}
+
+// topLevelClause returns the tokens of the clause starting with keyword
+// outside of any parenthesis, up to the first of the end keywords. It
+// returns nil if the clause is missing.
+func topLevelClause(tokens []Token, keyword string, end ...string) []Token {
+	depth := 0
+	begin := -1
+
+	for i, token := range tokens {
+		if token.is("(") {
+			depth++
+			continue
+		}
+		if token.is(")") {
+			depth--
+			continue
+		}
+		if depth != 0 {
+			continue
+		}
+
+		if begin == -1 && token.is(keyword) {
+			begin = i + 1
+			continue
+		}
+
+		if begin != -1 {
+			for _, keyword := range end {
+				if token.is(keyword) {
+					return tokens[begin:i]
+				}
+			}
+		}
+	}
+
+	if begin == -1 {
+		return nil
+	}
+
+	return tokens[begin:]
+}
+
+// splitTopLevel splits the condition on the given operator, ignoring the
+// ones between parenthesis
+func splitTopLevel(tokens []Token, operators ...string) [][]Token {
+	var parts [][]Token
+
+	depth := 0
+	last := 0
+
+	for i, token := range tokens {
+		if token.is("(") {
+			depth++
+		} else if token.is(")") {
+			depth--
+		} else if depth == 0 {
+			for _, operator := range operators {
+				if token.is(operator) {
+					parts = append(parts, tokens[last:i])
+					last = i + 1
+					break
+				}
+			}
+		}
+	}
+
+	return append(parts, tokens[last:])
+}
+
+// alwaysTrue reports whether a condition matches every row, i.e. it is
+// made only of constant true expressions like 1, TRUE, 1=1 or id=id
+func alwaysTrue(cond []Token) bool {
+	// Remove parenthesis wrapping the whole condition
+	for len(cond) >= 2 && cond[0].is("(") && cond[len(cond)-1].is(")") && balanced(cond[1:len(cond)-1]) {
+		cond = cond[1 : len(cond)-1]
+	}
+
+	if len(cond) == 0 {
+		return false
+	}
+
+	if ors := splitTopLevel(cond, "OR", "||"); len(ors) > 1 {
+		for _, part := range ors {
+			if alwaysTrue(part) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ands := splitTopLevel(cond, "AND", "&&"); len(ands) > 1 {
+		for _, part := range ands {
+			if !alwaysTrue(part) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if len(cond) == 1 {
+		token := cond[0]
+		switch token.Kind {
+		case tokenNumber:
+			value, err := strconv.ParseFloat(token.Value, 64)
+			return err == nil && value != 0
+		case tokenWord:
+			return token.is("TRUE")
+		}
+		return false
+	}
+
+	if len(cond) == 2 && cond[0].is("NOT") {
+		return cond[1].is("FALSE") || (cond[1].Kind == tokenNumber && cond[1].Value == "0")
+	}
+
+	if len(cond) == 3 {
+		return constantComparison(cond[0], cond[1], cond[2])
+	}
+
+	return false
+}
+
+// constantComparison reports whether "left op right" is true for every row
+func constantComparison(left Token, op Token, right Token) bool {
+	if op.Kind != tokenSymbol {
+		return false
+	}
+
+	// Comparing something with itself, e.g. 1=1, 'a'='a' or id=id. NULL
+	// never equals itself, except with the null safe operator.
+	if left == right && !left.is("NULL") {
+		switch op.Value {
+		case "=", "<=>", ">=", "<=":
+			return true
+		}
+	}
+
+	if left.Kind != tokenNumber || right.Kind != tokenNumber {
+		return false
+	}
+
+	a, errA := strconv.ParseFloat(left.Value, 64)
+	b, errB := strconv.ParseFloat(right.Value, 64)
+	if errA != nil || errB != nil {
+		return false
+	}
+
+	switch op.Value {
+	case "=", "<=>":
+		return a == b
+	case "<>", "!=":
+		return a != b
+	case "<":
+		return a < b
+	case ">":
+		return a > b
+	case "<=":
+		return a <= b
+	case ">=":
+		return a >= b
+	}
+
+	return false
+}
+
+// balanced reports whether the parenthesis of the tokens are balanced
+// without the depth ever going negative
+func balanced(tokens []Token) bool {
+	depth := 0
+
+	for _, token := range tokens {
+		if token.is("(") {
+			depth++
+		} else if token.is(")") {
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+	}
+
+	return depth == 0
+}
+
+// multiCharSymbols are the operators made of more than one character,
+// longest first
+var multiCharSymbols = []string{"<=>", "<=", ">=", "<>", "!=", ":=", "||", "&&", "->>", "->"}
+
+// tokenize splits a statement into tokens, dropping whitespace and comments.
+// The content of conditional comments (/*! ... */) is kept as it is
+// executed by the server.
+func tokenize(sql string) []Token {
+	var tokens []Token
+
+	runes := []rune(sql)
+	conditional := 0
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		rest := string(runes[i:min(i+3, len(runes))])
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '#' || (strings.HasPrefix(rest, "--") && (len(runes) == i+2 || unicode.IsSpace(runes[i+2]))):
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(rest, "/*!"):
+			i += 3
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			conditional++
+		case strings.HasPrefix(rest, "*/") && conditional > 0:
+			i += 2
+			conditional--
+		case strings.HasPrefix(rest, "/*"):
+			i += 2
+			for i < len(runes) && !(runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/') {
+				i++
+			}
+			i = min(i+2, len(runes))
+		case r == '\'' || r == '"' || r == '`':
+			value, next := readQuoted(runes, i)
+			kind := tokenString
+			if r == '`' {
+				kind = tokenIdentifier
+			}
+			tokens = append(tokens, Token{Kind: kind, Value: value})
+			i = next
+		case unicode.IsDigit(r) || r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]):
+			start := i
+			for i < len(runes) && (isWordRune(runes[i]) || runes[i] == '.' ||
+				(runes[i] == '+' || runes[i] == '-') && (runes[i-1] == 'e' || runes[i-1] == 'E')) {
+				i++
+			}
+			tokens = append(tokens, Token{Kind: tokenNumber, Value: string(runes[start:i])})
+		case isWordRune(r):
+			start := i
+			for i < len(runes) && isWordRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, Token{Kind: tokenWord, Value: string(runes[start:i])})
+		case r == '@':
+			start := i
+			i++
+			for i < len(runes) && (runes[i] == '@' || isWordRune(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, Token{Kind: tokenVariable, Value: string(runes[start:i])})
+		default:
+			symbol := string(r)
+			for _, candidate := range multiCharSymbols {
+				if strings.HasPrefix(string(runes[i:min(i+len(candidate), len(runes))]), candidate) {
+					symbol = candidate
+					break
+				}
+			}
+			tokens = append(tokens, Token{Kind: tokenSymbol, Value: symbol})
+			i += len([]rune(symbol))
+		}
+	}
+
+	return tokens
+}
+
+// readQuoted reads the quoted string or identifier starting at runes[start]
+// and returns its unescaped content along with the index following it
+func readQuoted(runes []rune, start int) (string, int) {
+	quote := runes[start]
+
+	var value strings.Builder
+
+	for i := start + 1; i < len(runes); i++ {
+		r := runes[i]
+
+		if r == '\\' && quote != '`' && i+1 < len(runes) {
+			i++
+			value.WriteRune(runes[i])
+			continue
+		}
+
+		if r == quote {
+			// Doubled quotes stand for the quote itself
+			if i+1 < len(runes) && runes[i+1] == quote {
+				value.WriteRune(quote)
+				i++
+				continue
+			}
+
+			return value.String(), i + 1
+		}
+
+		value.WriteRune(r)
+	}
+
+	return value.String(), len(runes)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$'
+}
+
+// Safe update policies, applied to UPDATE & DELETE statements without a
+// WHERE clause restricting the affected rows
+const (
+	SafeUpdatesOff   = "off"
+	SafeUpdatesWarn  = "warn"
+	SafeUpdatesBlock = "block"
+)
+
+// validateSafeUpdatePolicy makes sure the policy is a known one
+func validateSafeUpdatePolicy(policy string) error {
+	switch policy {
+	case SafeUpdatesOff, SafeUpdatesWarn, SafeUpdatesBlock:
+		return nil
+	}
+
+	return fmt.Errorf("Invalid safe updates policy %q, expected off, warn or block", policy)
+}
+
+// safeUpdateMessage returns the message explaining why the statement is
+// considered unsafe, or an empty string if it is not
+func safeUpdateMessage(info StatementInfo) string {
+	if !info.UnsafeUpdate() {
+		return ""
+	}
+
+	if info.TrivialWhere {
+		return fmt.Sprintf("WHERE clause of the %s statement matches every row", info.Type)
+	}
+
+	return fmt.Sprintf("%s statement without WHERE clause affects every row", info.Type)
+}
+
+// SafeUpdates returns the safe update policy of the client
+func (client *Client) SafeUpdates() string {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.safeUpdates == "" {
+		return SafeUpdatesBlock
+	}
+
+	return client.safeUpdates
+}
+
+// SetSafeUpdates changes the safe update policy of the client
+func (client *Client) SetSafeUpdates(policy string) error {
+	if err := validateSafeUpdatePolicy(policy); err != nil {
+		return err
+	}
+
+	client.mu.Lock()
+	client.safeUpdates = policy
+	client.mu.Unlock()
+
+	return nil
+}
+
+// checkSafeUpdate applies the safe update policy to the statement. It
+// returns an error if the statement must not run, or a warning to report
+// along with its result.
+func (client *Client) checkSafeUpdate(query string) (string, error) {
+	message := safeUpdateMessage(classifyStatement(query))
+	if message == "" {
+		return "", nil
+	}
+
+	switch client.SafeUpdates() {
+	case SafeUpdatesBlock:
+		return "", errors.New(message)
+	case SafeUpdatesWarn:
+		return message, nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyStatement_Type(t *testing.T) {
+	tests := map[string]StatementInfo{
+		"SELECT last_update FROM t":                     {Type: "SELECT", Kind: KindRead},
+		"select deleted_at from t":                      {Type: "SELECT", Kind: KindRead},
+		"/* UPDATE */ SELECT 'DELETE FROM t'":           {Type: "SELECT", Kind: KindRead},
+		"(SELECT 1) UNION (SELECT 2)":                   {Type: "SELECT", Kind: KindRead},
+		"INSERT INTO t VALUES (1)":                      {Type: "INSERT", Kind: KindWrite},
+		"CREATE TABLE t (id INT)":                       {Type: "CREATE", Kind: KindDDL},
+		"use shop":                                      {Type: "USE", Kind: KindSession},
+		"WITH x AS (SELECT 1) SELECT * FROM x":          {Type: "SELECT", Kind: KindRead},
+		"WITH x AS (SELECT 1) DELETE FROM t WHERE id=1": {Type: "DELETE", Kind: KindWrite, HasWhere: true},
+		"KILL 12":    {Type: "KILL", Kind: KindOther},
+		"-- nothing": {Kind: KindOther},
+	}
+
+	for sql, expected := range tests {
+		assert.Equal(t, expected, classifyStatement(sql), sql)
+	}
+}
+
+func TestClassifyStatement_UnsafeUpdate(t *testing.T) {
+	unsafe := []string{
+		"DELETE FROM t",
+		"UPDATE t SET a = 1",
+		"DELETE FROM t WHERE 1=1",
+		"DELETE FROM t WHERE 1",
+		"delete from t where true",
+		"UPDATE t SET a = 1 WHERE (1 = 1)",
+		"UPDATE t SET a = 1 WHERE id = id",
+		"DELETE FROM t WHERE 'a' = 'a' ORDER BY id",
+		"DELETE FROM t WHERE id = 5 OR 1=1",
+		"DELETE FROM t WHERE 1=1 AND 2>1",
+		"UPDATE t SET a = (SELECT b FROM u WHERE u.id = 1)",
+		"DELETE FROM t LIMIT 10",
+	}
+
+	for _, sql := range unsafe {
+		assert.True(t, classifyStatement(sql).UnsafeUpdate(), sql)
+	}
+
+	safe := []string{
+		"DELETE FROM t WHERE id = 5",
+		"UPDATE t SET a = 1 WHERE id IN (1, 2)",
+		"DELETE FROM t WHERE 1=1 AND id = 3",
+		"UPDATE t SET a = 'where' WHERE b = 2",
+		"DELETE FROM t WHERE a = NULL",
+		"UPDATE `where` SET a = 1 WHERE id = 2",
+		"SELECT last_update FROM t",
+		"SELECT * FROM deleted_at",
+	}
+
+	for _, sql := range safe {
+		assert.False(t, classifyStatement(sql).UnsafeUpdate(), sql)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := tokenize("SELECT `a``b`, 'it''s', @x, 1.5e+3 /* skip */ FROM t -- tail\nWHERE a<=>b /*!40101 AND c */")
+
+	assert.Equal(t, []Token{
+		{tokenWord, "SELECT"},
+		{tokenIdentifier, "a`b"},
+		{tokenSymbol, ","},
+		{tokenString, "it's"},
+		{tokenSymbol, ","},
+		{tokenVariable, "@x"},
+		{tokenSymbol, ","},
+		{tokenNumber, "1.5e+3"},
+		{tokenWord, "FROM"},
+		{tokenWord, "t"},
+		{tokenWord, "WHERE"},
+		{tokenWord, "a"},
+		{tokenSymbol, "<=>"},
+		{tokenWord, "b"},
+		{tokenWord, "AND"},
+		{tokenWord, "c"},
+	}, tokens)
+}
+
+func TestValidateSafeUpdatePolicy(t *testing.T) {
+	assert.NoError(t, validateSafeUpdatePolicy(SafeUpdatesWarn))
+	assert.Error(t, validateSafeUpdatePolicy("sometimes"))
+}
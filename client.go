@@ -2,21 +2,54 @@ package main
 
 import (
 	"bytes"
-	"encoding/csv"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"reflect"
+	"net"
+	"sync"
 	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
-	uuid "github.com/nu7hatch/gouuid"
 )
 
+// ErrQueryNotFound is returned when cancelling a query that is not running
+var ErrQueryNotFound = errors.New("Query is not running")
+
 // Client is our SQL client
 type Client struct {
 	db      *sqlx.DB
-	history []Query
+	mu      sync.Mutex
+	running map[string]*runningQuery
 	host    string
 	user    string
+	// Database of the connection string
+	dbName string
+
+	// Connection pinned for the interactive work, see withSession
+	connMu   sync.Mutex
+	conn     *sqlx.Conn
+	threadID int64
+	// Default database of the session, changed with both connMu and mu
+	// held so it can be read holding either
+	database string
+
+	// Start of the open transaction, guarded by mu
+	txStarted time.Time
+
+	// Safe update policy, guarded by mu
+	safeUpdates string
+
+	// Only statements reading data are allowed, set before first use
+	readOnly bool
+}
+
+// runningQuery is a query being executed on the server
+type runningQuery struct {
+	threadID int64
+	cancel   context.CancelFunc
 }
 
 // Row will hold rows of our SQL table
@@ -24,43 +57,81 @@ type Row []interface{}
 
 // Result will hold our SQL query resultset
 type Result struct {
-	Columns []string `json:"columns"`
-	Rows    []Row    `json:"rows"`
+	Columns     []string     `json:"columns"`
+	ColumnTypes []ColumnInfo `json:"column_types,omitempty"`
+	Rows        []Row        `json:"rows"`
 }
 
-// Query
+// Query is an entry of the query history, keyed by the host, user and
+// database it was executed with. It is recorded once the query finished,
+// along with its outcome.
 type Query struct {
-	Timestamp int64  `json:"timestamp"`
-	Query     string `json:"query"`
+	ID           int64  `json:"id"`
+	Timestamp    int64  `json:"timestamp"`
+	Query        string `json:"query"`
+	Host         string `json:"host"`
+	User         string `json:"user"`
+	Database     string `json:"database,omitempty"`
+	Origin       string `json:"origin,omitempty"`
+	Duration     int64  `json:"duration_ms"`
+	RowsReturned int64  `json:"rows_returned"`
+	RowsAffected int64  `json:"rows_affected"`
+	Status       string `json:"status,omitempty"`
+	Error        string `json:"error,omitempty"`
 }
 
 // NewClientFromURL will create a new mysql client using the URL provided in parameters
-func NewClientFromURL(url string) (string, error) {
+func NewClientFromURL(url string) (*Client, error) {
 	db, err := sqlx.Open("mysql", url)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	user, host, _, _ := getConnParametersFromString(url)
+	user, host, dbName, _ := getConnParametersFromString(url)
+
+	return &Client{
+		db:          db,
+		host:        host,
+		user:        user,
+		dbName:      dbName,
+		running:     make(map[string]*runningQuery),
+		safeUpdates: options.SafeUpdates,
+	}, nil
+}
 
-	u4, err := uuid.NewV4()
+// NewClientFromConfig will create a new mysql client using the driver
+// configuration, for settings that don't fit in a URL such as custom TLS
+func NewClientFromConfig(cfg *mysql.Config) (*Client, error) {
+	connector, err := mysql.NewConnector(cfg)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	strUuid := u4.String()
-
-	dbClientMap[strUuid] = &Client{db: db, host: host, user: user}
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		host = cfg.Addr
+	}
 
-	return strUuid, nil
+	return &Client{
+		db:          sqlx.NewDb(sql.OpenDB(connector), "mysql"),
+		host:        host,
+		user:        cfg.User,
+		dbName:      cfg.DBName,
+		running:     make(map[string]*runningQuery),
+		safeUpdates: options.SafeUpdates,
+	}, nil
 }
 
 // Close disconnects a existing connection
 func (client *Client) Close() error {
-	// Clear history
-	client.history = nil
-	client.host = ""
-	client.user = ""
+	client.mu.Lock()
+	for _, query := range client.running {
+		query.cancel()
+	}
+	client.mu.Unlock()
+
+	client.closeSession()
+
 	return client.db.Close()
 }
 
@@ -69,21 +140,82 @@ func (client *Client) Test() error {
 	return client.db.Ping()
 }
 
-func (client *Client) recordQuery(query string) {
-	saveQuery := Query{
-		Timestamp: time.Now().UTC().Unix(),
-		Query:     query,
+// recordExecution adds a query executed since start to the history along
+// with its outcome. entry holds the query, its origin and the row counts,
+// the database defaulting to the one of the connection string.
+func (client *Client) recordExecution(entry Query, start time.Time, err error) {
+	entry.Duration = time.Since(start).Milliseconds()
+	entry.Status = HistorySuccess
+
+	if err != nil {
+		entry.Status = HistoryError
+		entry.Error = err.Error()
 	}
-	client.history = prepend(saveQuery, client.history)
+
+	client.record(entry)
 }
 
-func prepend(v Query, slice []Query) []Query {
-	return append([]Query{v}, slice...)
+// record stamps the entry with the time and the connection and appends it to
+// the history. The query still runs when the history can't be written.
+func (client *Client) record(entry Query) {
+	if history == nil {
+		return
+	}
+
+	entry.Timestamp = time.Now().UTC().Unix()
+	entry.Host = client.host
+	entry.User = client.user
+
+	if entry.Database == "" {
+		entry.Database = client.dbName
+	}
+
+	if err := history.Append(entry); err != nil {
+		fmt.Println("Error:", err)
+	}
 }
 
-// Info of our connected database
+// History searches the history of the host and user of the client, newest
+// first
+func (client *Client) History(filter HistoryFilter) ([]Query, error) {
+	if history == nil {
+		return []Query{}, nil
+	}
+
+	filter.Host = client.host
+	filter.User = client.user
+
+	return history.Search(filter)
+}
+
+// sessionDatabase returns the default database of the session connection.
+// Must be called with connMu or mu held.
+func (client *Client) sessionDatabase() string {
+	if client.database != "" {
+		return client.database
+	}
+
+	return client.dbName
+}
+
+// currentDatabase is sessionDatabase for callers not holding connMu
+func (client *Client) currentDatabase() string {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	return client.sessionDatabase()
+}
+
+// Info of our connected database. It runs on the pool rather than on the
+// session connection, so it doesn't wait for the query running there, and
+// reports the default database of the session.
 func (client *Client) Info() (*Result, error) {
-	return client.Query(MySQLInfo)
+	var database interface{}
+	if name := client.currentDatabase(); name != "" {
+		database = name
+	}
+
+	return client.Query(MySQLInfo, database)
 }
 
 // Databases will list all the databases in the system
@@ -104,7 +236,7 @@ func (client *Client) Databases() ([]string, error) {
 
 // DatabaseTables will give you list of tables belonging to the database
 func (client *Client) DatabaseTables(database string) ([]string, error) {
-	res, err := client.Query(fmt.Sprintf(MySQLDatabaseTables, database))
+	res, err := client.Query(MySQLDatabaseTables, database)
 	if err != nil {
 		return nil, err
 	}
@@ -120,7 +252,7 @@ func (client *Client) DatabaseTables(database string) ([]string, error) {
 
 // DatabaseViews will give you list of views belonging to the database
 func (client *Client) DatabaseViews(database string) ([]string, error) {
-	res, err := client.Query(fmt.Sprintf(MySQLDatabaseViews, database))
+	res, err := client.Query(MySQLDatabaseViews, database)
 	if err != nil {
 		return nil, err
 	}
@@ -136,7 +268,7 @@ func (client *Client) DatabaseViews(database string) ([]string, error) {
 
 // DatabaseProcedures returns a list of all the stored procedures in the database
 func (client *Client) DatabaseProcedures(database string) ([]string, error) {
-	res, err := client.Query(fmt.Sprintf(MySQLDatabaseProcedures, database))
+	res, err := client.Query(MySQLDatabaseProcedures, database)
 	if err != nil {
 		return nil, err
 	}
@@ -152,7 +284,7 @@ func (client *Client) DatabaseProcedures(database string) ([]string, error) {
 
 // DatabaseFunctions returns a list of all the functions in the database
 func (client *Client) DatabaseFunctions(database string) ([]string, error) {
-	res, err := client.Query(fmt.Sprintf(MySQLDatabaseFunctions, database))
+	res, err := client.Query(MySQLDatabaseFunctions, database)
 	if err != nil {
 		return nil, err
 	}
@@ -168,12 +300,12 @@ func (client *Client) DatabaseFunctions(database string) ([]string, error) {
 
 // TableInfo will return info like data used, row count etc.
 func (client *Client) TableInfo(table string) (*Result, error) {
-	return client.Query(fmt.Sprintf(MySQLTableInfo, table))
+	return client.Query(MySQLTableInfo, table)
 }
 
 // TableIndexes returns all the indexes of the table
 func (client *Client) TableIndexes(table string) (*Result, error) {
-	res, err := client.Query(fmt.Sprintf(MySQLTableIndexs, table))
+	res, err := client.Query(MySQLTableIndexs, table)
 	if err != nil {
 		return nil, err
 	}
@@ -182,7 +314,7 @@ func (client *Client) TableIndexes(table string) (*Result, error) {
 }
 
 func (client *Client) TableColumns(database string, table string) (*Result, error) {
-	res, err := client.Query(fmt.Sprintf(MySQLTableColumns, database, table))
+	res, err := client.Query(MySQLTableColumns, database, table)
 	if err != nil {
 		return nil, err
 	}
@@ -192,7 +324,7 @@ func (client *Client) TableColumns(database string, table string) (*Result, erro
 
 // ProcedureParameters returns all the paramaters of a stored procedure
 func (client *Client) ProcedureParameters(procedure string, database string) (*Result, error) {
-	res, err := client.Query(fmt.Sprintf(MySQLProcedureParameters, procedure, database))
+	res, err := client.Query(MySQLProcedureParameters, procedure, database)
 	if err != nil {
 		return nil, err
 	}
@@ -212,7 +344,15 @@ func (client *Client) DatabaseCollationCharSet() (*Result, error) {
 
 // AlterDatabase let's you set character set & collation of the database
 func (client *Client) AlterDatabase(database string, charset string, collation string) (*Result, error) {
-	res, err := client.Query(fmt.Sprintf(MySQLDatabaseAlter, database, charset, collation))
+	if err := validateCharsetName(charset); err != nil {
+		return nil, err
+	}
+
+	if err := validateCharsetName(collation); err != nil {
+		return nil, err
+	}
+
+	res, err := client.UserQuery(fmt.Sprintf(MySQLDatabaseAlter, quoteIdentifier(database), charset, collation))
 	if err != nil {
 		return nil, err
 	}
@@ -222,7 +362,7 @@ func (client *Client) AlterDatabase(database string, charset string, collation s
 
 // DropDatabase will drop the database from the system
 func (client *Client) DropDatabase(database string) (*Result, error) {
-	res, err := client.Query(fmt.Sprintf(MySQLDatabaseDrop, database))
+	res, err := client.UserQuery(fmt.Sprintf(MySQLDatabaseDrop, quoteIdentifier(database)))
 	if err != nil {
 		return nil, err
 	}
@@ -232,7 +372,7 @@ func (client *Client) DropDatabase(database string) (*Result, error) {
 
 // DropTable will drop the table from selected database
 func (client *Client) DropTable(database string, table string) (*Result, error) {
-	res, err := client.Query(fmt.Sprintf(MySQLTableDrop, database, table))
+	res, err := client.UserQuery(fmt.Sprintf(MySQLTableDrop, quoteIdentifier(database), quoteIdentifier(table)))
 	if err != nil {
 		return nil, err
 	}
@@ -242,7 +382,7 @@ func (client *Client) DropTable(database string, table string) (*Result, error)
 
 // TruncateTable will truncate the table
 func (client *Client) TruncateTable(database string, table string) (*Result, error) {
-	res, err := client.Query(fmt.Sprintf(MySQLTableTruncate, database, table))
+	res, err := client.UserQuery(fmt.Sprintf(MySQLTableTruncate, quoteIdentifier(database), quoteIdentifier(table)))
 	if err != nil {
 		return nil, err
 	}
@@ -252,7 +392,12 @@ func (client *Client) TruncateTable(database string, table string) (*Result, err
 
 // ProcedureDefinition will give you the create statement of procedure/function
 func (client *Client) ProcedureDefinition(procType string, database string, name string) (*Result, error) {
-	res, err := client.Query(fmt.Sprintf(MySQLProcedureDefinition, procType, database, name))
+	procType, err := routineType(procType)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.Query(fmt.Sprintf(MySQLProcedureDefinition, procType, quoteIdentifier(database), quoteIdentifier(name)))
 	if err != nil {
 		return nil, err
 	}
@@ -261,7 +406,12 @@ func (client *Client) ProcedureDefinition(procType string, database string, name
 }
 
 func (client *Client) DropProcedure(procType string, database string, name string) (bool, error) {
-	_, err := client.Execute(fmt.Sprintf(MySQLProcedureDrop, procType, database, name))
+	procType, err := routineType(procType)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = client.Execute(fmt.Sprintf(MySQLProcedureDrop, procType, quoteIdentifier(database), quoteIdentifier(name)))
 	if err != nil {
 		return false, err
 	}
@@ -270,16 +420,25 @@ func (client *Client) DropProcedure(procType string, database string, name strin
 }
 
 func (client *Client) ProcedureCreate(procType string, database string, name string, definition string) (bool, error) {
+	procType, err := routineType(procType)
+	if err != nil {
+		return false, err
+	}
+
 	trans, err := client.db.Begin()
 	if err != nil {
 		return false, err
 	}
+	defer trans.Rollback()
 
 	// set this as default database
-	_, err = trans.Exec(fmt.Sprintf("use %s;", database))
+	_, err = trans.Exec(fmt.Sprintf(MySQLUseDatabase, quoteIdentifier(database)))
+	if err != nil {
+		return false, err
+	}
 
 	// Drop existing procedure
-	_, err = trans.Exec(fmt.Sprintf(MySQLProcedureDrop, procType, database, name))
+	_, err = trans.Exec(fmt.Sprintf(MySQLProcedureDrop, procType, quoteIdentifier(database), quoteIdentifier(name)))
 	if err != nil {
 		return false, err
 	}
@@ -297,11 +456,15 @@ func (client *Client) ProcedureCreate(procType string, database string, name str
 		return false, err
 	}
 
+	if err := trans.Commit(); err != nil {
+		return false, err
+	}
+
 	return true, nil
 }
 
 func (client *Client) ViewDefinition(database string, name string) (*Result, error) {
-	res, err := client.Query(fmt.Sprintf(MySQLViewDefinition, database, name))
+	res, err := client.Query(fmt.Sprintf(MySQLViewDefinition, quoteIdentifier(database), quoteIdentifier(name)))
 	if err != nil {
 		return nil, err
 	}
@@ -310,25 +473,28 @@ func (client *Client) ViewDefinition(database string, name string) (*Result, err
 }
 
 func (client *Client) Search(query string) (*Result, error) {
+	pattern := "%" + escapeLike(query) + "%"
+
 	// Search in table list
-	resTbl, err := client.Query(fmt.Sprintf(MySQLSearchTable, query))
+	resTbl, err := client.Query(MySQLSearchTable, pattern)
 	if err != nil {
 		return nil, err
 	}
 
-	resProc, err := client.Query(fmt.Sprintf(MySQLSearchProcedure, query))
+	resProc, err := client.Query(MySQLSearchProcedure, pattern)
 	if err != nil {
 		return nil, err
 	}
 
-	resFunc, err := client.Query(fmt.Sprintf(MySQLSearchFunction, query))
+	resFunc, err := client.Query(MySQLSearchFunction, pattern)
 	if err != nil {
 		return nil, err
 	}
 
 	resMerge := Result{
-		Columns: resTbl.Columns,
-		Rows:    append(resTbl.Rows, resProc.Rows...),
+		Columns:     resTbl.Columns,
+		ColumnTypes: resTbl.ColumnTypes,
+		Rows:        append(resTbl.Rows, resProc.Rows...),
 	}
 
 	resMerge.Rows = append(resMerge.Rows, resFunc.Rows...)
@@ -336,61 +502,255 @@ func (client *Client) Search(query string) (*Result, error) {
 	return &resMerge, err
 }
 
-// Query will execute the sql query passed as parameter, and return the resultset
-func (client *Client) Query(query string) (*Result, error) {
-	rows, err := client.db.Queryx(query)
+// Query will execute the sql query passed as parameter, and return the
+// resultset. Values passed in args are bound to the ? placeholders of query.
+// It is recorded as an internal query in the history.
+func (client *Client) Query(query string, args ...interface{}) (*Result, error) {
+	return client.query(OriginInternal, query, args...)
+}
+
+// UserQuery is Query for the statements run on behalf of the user
+func (client *Client) UserQuery(query string, args ...interface{}) (*Result, error) {
+	return client.query(OriginUser, query, args...)
+}
 
-	client.recordQuery(query)
+func (client *Client) query(origin string, query string, args ...interface{}) (*Result, error) {
+	entry := Query{Query: query, Origin: origin}
+	start := time.Now()
 
+	rows, err := client.db.Queryx(query, args...)
 	if err != nil {
+		client.recordExecution(entry, start, err)
 		return nil, err
 	}
 
 	defer rows.Close()
 
-	cols, err := rows.Columns()
+	result, err := readResult(rows)
+	if result != nil {
+		entry.RowsReturned = int64(len(result.Rows))
+	}
+
+	client.recordExecution(entry, start, err)
+
+	return result, err
+}
+
+// readResult reads the whole resultset
+func readResult(rows *sqlx.Rows) (*Result, error) {
+	columnTypes, err := rows.ColumnTypes()
 	if err != nil {
 		return nil, err
 	}
 
+	cols := columnInfos(columnTypes)
 	result := Result{
-		Columns: cols,
+		Columns:     columnNames(cols),
+		ColumnTypes: cols,
 	}
 
 	for rows.Next() {
-		obj, err := rows.SliceScan()
+		obj, err := scanRow(rows, cols)
 
-		for i, item := range obj {
-			if item == nil {
-				obj[i] = nil
-			} else {
-				t := reflect.TypeOf(item).Kind().String()
+		if err == nil {
+			result.Rows = append(result.Rows, obj)
+		}
+	}
 
-				if t == "slice" {
-					obj[i] = string(item.([]byte))
-				}
+	return &result, nil
+}
+
+// Stream executes the query and hands the resultset to w row by row as it is
+// read, without buffering it. At most maxRows rows are written, 0 means no
+// limit. Errors happening before the columns are written are returned as is,
+// later ones are reported to w.Close.
+//
+// The query runs under queryID until it finishes, so it can be cancelled with
+// CancelQuery. It is also killed on the server once ctx is done, which keeps
+// the session connection and its transaction open. Values passed in args are
+// bound to the ? placeholders of query.
+func (client *Client) Stream(ctx context.Context, queryID string, query string, maxRows int, w RowWriter, args ...interface{}) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	return client.withSession(ctx, func(sessionCtx context.Context, conn *sqlx.Conn, threadID int64) error {
+		stop := client.watchQuery(ctx, queryID, threadID, cancel)
+		defer stop()
+
+		start := time.Now()
+		database := client.sessionDatabase()
+
+		if !returnsRows(query) {
+			return client.streamExec(sessionCtx, conn, query, database, start, w, args...)
+		}
+
+		rows, err := conn.QueryxContext(sessionCtx, query, args...)
+		if err != nil {
+			client.recordExecution(Query{Query: query, Database: database, Origin: OriginUser}, start, err)
+			return err
+		}
+
+		defer rows.Close()
+
+		columnTypes, err := rows.ColumnTypes()
+		if err != nil {
+			return err
+		}
+
+		cols := columnInfos(columnTypes)
+		if err := w.WriteColumns(cols); err != nil {
+			return err
+		}
+
+		count := 0
+		truncated := false
+
+		for rows.Next() {
+			if maxRows > 0 && count >= maxRows {
+				truncated = true
+				break
+			}
+
+			obj, err := scanRow(rows, cols)
+			if err != nil {
+				client.recordExecution(Query{Query: query, Database: database, Origin: OriginUser, RowsReturned: int64(count)}, start, err)
+				return w.Close(false, err)
+			}
+
+			if err := w.WriteRow(obj); err != nil {
+				return err
 			}
+
+			count++
 		}
 
-		if err == nil {
-			result.Rows = append(result.Rows, obj)
+		err = rows.Err()
+		rows.Close()
+
+		client.recordExecution(Query{Query: query, Database: database, Origin: OriginUser, RowsReturned: int64(count)}, start, err)
+
+		client.trackSession(sessionCtx, conn, query)
+
+		return w.Close(truncated, err)
+	})
+}
+
+// streamExec runs a statement without resultset for Stream, reporting the
+// number of affected rows to w when it supports it. Must be called with
+// connMu held.
+func (client *Client) streamExec(ctx context.Context, conn *sqlx.Conn, query string, database string, start time.Time, w RowWriter, args ...interface{}) error {
+	entry := Query{Query: query, Database: database, Origin: OriginUser}
+
+	res, err := conn.ExecContext(ctx, query, args...)
+	if err == nil {
+		entry.RowsAffected, err = res.RowsAffected()
+	}
+
+	client.recordExecution(entry, start, err)
+
+	if err != nil {
+		return err
+	}
+
+	client.trackSession(ctx, conn, query)
+
+	if aw, ok := w.(RowsAffectedWriter); ok {
+		aw.SetRowsAffected(entry.RowsAffected)
+	}
+
+	if err := w.WriteColumns([]ColumnInfo{}); err != nil {
+		return err
+	}
+
+	return w.Close(false, nil)
+}
+
+// watchQuery registers the query running on threadID and kills it on the
+// server as soon as ctx is done. The returned function unregisters the query
+// and must be called before the connection is released to the pool.
+func (client *Client) watchQuery(ctx context.Context, queryID string, threadID int64, cancel context.CancelFunc) func() {
+	client.mu.Lock()
+	client.running[queryID] = &runningQuery{threadID: threadID, cancel: cancel}
+	client.mu.Unlock()
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+
+		select {
+		case <-ctx.Done():
+			client.killQuery(threadID)
+		case <-done:
 		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+
+		client.mu.Lock()
+		delete(client.running, queryID)
+		client.mu.Unlock()
 	}
+}
 
-	return &result, nil
+// killQuery stops the statement being executed by the given connection thread
+func (client *Client) killQuery(threadID int64) error {
+	_, err := client.db.Exec(fmt.Sprintf(MySQLKillQuery, threadID))
+	return err
+}
+
+// CancelQuery cancels the running query registered under queryID
+func (client *Client) CancelQuery(queryID string) error {
+	client.mu.Lock()
+	query, ok := client.running[queryID]
+	client.mu.Unlock()
+
+	if !ok {
+		return ErrQueryNotFound
+	}
+
+	query.cancel()
+
+	return nil
+}
+
+// scanRow reads the current row, decoding the values according to the type
+// of their column
+func scanRow(rows *sqlx.Rows, cols []ColumnInfo) (Row, error) {
+	obj, err := rows.SliceScan()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, item := range obj {
+		obj[i] = decodeValue(item, cols[i].Type)
+	}
+
+	return obj, nil
 }
 
-func (client *Client) Execute(query string) (int64, error) {
-	res, err := client.db.Exec(query)
+func (client *Client) Execute(query string, args ...interface{}) (int64, error) {
+	entry := Query{Query: query, Origin: OriginUser}
+	start := time.Now()
+
+	res, err := client.db.Exec(query, args...)
 	if err != nil {
+		client.recordExecution(entry, start, err)
 		return -1, err
 	}
 
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
+		client.recordExecution(entry, start, err)
 		return -1, err
 	}
 
+	entry.RowsAffected = rowsAffected
+	client.recordExecution(entry, start, nil)
+
 	return rowsAffected, nil
 }
 
@@ -412,30 +772,39 @@ func (res *Result) Format() []map[string]interface{} {
 }
 
 // CSV will format the sql resultset as CSV
-func (res *Result) CSV() []byte {
+func (res *Result) CSV(opts CSVOptions) []byte {
 	buff := &bytes.Buffer{}
-	writer := csv.NewWriter(buff)
-
-	writer.Write(res.Columns)
-
-	for _, row := range res.Rows {
-		record := make([]string, len(res.Columns))
+	writer := newCSVRowWriter(buff, opts)
 
-		for i, item := range row {
-			if item != nil {
-				record[i] = fmt.Sprintf("%v", item)
-			} else {
-				record[i] = ""
-			}
+	columns := res.ColumnTypes
+	if len(columns) != len(res.Columns) {
+		columns = make([]ColumnInfo, len(res.Columns))
+		for i, name := range res.Columns {
+			columns[i] = ColumnInfo{Name: name}
 		}
+	}
 
-		err := writer.Write(record)
-		if err != nil {
-			fmt.Println(err)
-			break
-		}
+	writer.WriteColumns(columns)
+
+	for _, row := range res.Rows {
+		writer.WriteRow(row)
 	}
 
-	writer.Flush()
+	writer.Close(false, nil)
 	return buff.Bytes()
 }
+
+// textValue formats a value as plain text, NULL being an empty string and
+// binary values being encoded in full
+func textValue(item interface{}) string {
+	switch value := item.(type) {
+	case nil:
+		return ""
+	case json.RawMessage:
+		return string(value)
+	case Binary:
+		return value.String()
+	default:
+		return fmt.Sprintf("%v", item)
+	}
+}
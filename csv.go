@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Quoting styles of CSV fields
+const (
+	// QuoteMinimal quotes the fields containing special characters only
+	QuoteMinimal = "minimal"
+	// QuoteAll quotes every field but NULL
+	QuoteAll = "all"
+	// QuoteNonNumeric quotes every field but numbers and NULL
+	QuoteNonNumeric = "nonnumeric"
+	// QuoteNone never quotes, special characters are escaped with a
+	// backslash the way LOAD DATA expects them
+	QuoteNone = "none"
+)
+
+// CSVOptions controls how resultsets are written as CSV
+type CSVOptions struct {
+	Delimiter rune
+	Quote     string
+	// Null is written for NULL values, never quoted
+	Null   string
+	Header bool
+	CRLF   bool
+	// BOM prepends the UTF-8 byte order mark Excel needs to detect the
+	// encoding
+	BOM bool
+}
+
+// DefaultCSVOptions returns the options of a plain RFC 4180 CSV file
+func DefaultCSVOptions() CSVOptions {
+	return CSVOptions{
+		Delimiter: ',',
+		Quote:     QuoteMinimal,
+		Header:    true,
+	}
+}
+
+// parseCSVOptions reads the delimiter, quote, null, header, line_ending and
+// bom parameters, falling back to defaults for the missing ones
+func parseCSVOptions(params url.Values, defaults CSVOptions) (CSVOptions, error) {
+	opts := defaults
+
+	if delimiter := params.Get("delimiter"); delimiter != "" {
+		if delimiter == "tab" || delimiter == `\t` {
+			delimiter = "\t"
+		}
+
+		r, size := utf8.DecodeRuneInString(delimiter)
+		if size != len(delimiter) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+			return opts, fmt.Errorf("Invalid delimiter %q", delimiter)
+		}
+		opts.Delimiter = r
+	}
+
+	if quote := params.Get("quote"); quote != "" {
+		switch quote {
+		case QuoteMinimal, QuoteAll, QuoteNonNumeric, QuoteNone:
+			opts.Quote = quote
+		default:
+			return opts, fmt.Errorf("Invalid quote style %q, expected minimal, all, nonnumeric or none", quote)
+		}
+	}
+
+	if opts.Quote == QuoteNone && opts.Delimiter == '\\' {
+		return opts, fmt.Errorf("Backslash can't be the delimiter when fields are not quoted")
+	}
+
+	if _, ok := params["null"]; ok {
+		opts.Null = params.Get("null")
+	}
+
+	if header := params.Get("header"); header != "" {
+		value, err := strconv.ParseBool(header)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid header value %q", header)
+		}
+		opts.Header = value
+	}
+
+	switch strings.ToLower(params.Get("line_ending")) {
+	case "":
+	case "lf":
+		opts.CRLF = false
+	case "crlf":
+		opts.CRLF = true
+	default:
+		return opts, fmt.Errorf("Invalid line ending %q, expected lf or crlf", params.Get("line_ending"))
+	}
+
+	if bom := params.Get("bom"); bom != "" {
+		value, err := strconv.ParseBool(bom)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid bom value %q", bom)
+		}
+		opts.BOM = value
+	}
+
+	return opts, nil
+}
+
+// csvRowWriter writes the resultset as CSV, or any other delimiter
+// separated format, each record being handed over to w as soon as it is
+// formatted
+type csvRowWriter struct {
+	w     io.Writer
+	opts  CSVOptions
+	types []string
+}
+
+func newCSVRowWriter(w io.Writer, opts CSVOptions) *csvRowWriter {
+	return &csvRowWriter{w: w, opts: opts}
+}
+
+func (cw *csvRowWriter) WriteColumns(columns []ColumnInfo) error {
+	if cw.opts.BOM {
+		if _, err := io.WriteString(cw.w, "\ufeff"); err != nil {
+			return err
+		}
+	}
+
+	cw.types = make([]string, len(columns))
+	for i, column := range columns {
+		cw.types[i] = column.Type
+	}
+
+	if !cw.opts.Header {
+		return nil
+	}
+
+	fields := make([]string, len(columns))
+	for i, column := range columns {
+		fields[i] = cw.field(column.Name, false)
+	}
+
+	return cw.write(fields)
+}
+
+func (cw *csvRowWriter) WriteRow(row Row) error {
+	fields := make([]string, len(row))
+
+	for i, item := range row {
+		if item == nil {
+			fields[i] = cw.opts.Null
+			continue
+		}
+
+		fields[i] = cw.field(textValue(item), isNumber(item, cw.types[i]))
+	}
+
+	return cw.write(fields)
+}
+
+func (cw *csvRowWriter) Close(truncated bool, err error) error {
+	return nil
+}
+
+func (cw *csvRowWriter) write(fields []string) error {
+	lineEnding := "\n"
+	if cw.opts.CRLF {
+		lineEnding = "\r\n"
+	}
+
+	_, err := io.WriteString(cw.w, strings.Join(fields, string(cw.opts.Delimiter))+lineEnding)
+	return err
+}
+
+// field formats a non NULL value according to the quoting style
+func (cw *csvRowWriter) field(text string, numeric bool) string {
+	switch cw.opts.Quote {
+	case QuoteAll:
+		return quoteField(text)
+	case QuoteNonNumeric:
+		if numeric {
+			return text
+		}
+		return quoteField(text)
+	case QuoteNone:
+		return cw.escapeField(text)
+	}
+
+	// A value looking like the NULL marker must be quoted to tell them apart
+	if cw.needsQuotes(text) || (cw.opts.Null != "" && text == cw.opts.Null) {
+		return quoteField(text)
+	}
+
+	return text
+}
+
+// needsQuotes reports whether the field can't be written as is, following
+// the rules of the encoding/csv package
+func (cw *csvRowWriter) needsQuotes(text string) bool {
+	if text == "" {
+		return false
+	}
+
+	if strings.ContainsRune(text, cw.opts.Delimiter) || strings.ContainsAny(text, "\"\r\n") {
+		return true
+	}
+
+	r, _ := utf8.DecodeRuneInString(text)
+	return r == ' ' || r == '\t'
+}
+
+// escapeField escapes the backslashes, delimiters and line breaks of an
+// unquoted field with a backslash
+func (cw *csvRowWriter) escapeField(text string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		string(cw.opts.Delimiter), `\`+string(cw.opts.Delimiter),
+		"\n", `\n`,
+		"\r", `\r`,
+	)
+
+	return replacer.Replace(text)
+}
+
+// quoteField wraps the field in double quotes, doubling the ones it contains
+func quoteField(text string) string {
+	return `"` + strings.ReplaceAll(text, `"`, `""`) + `"`
+}
+
+// isNumber reports whether the value is a number, including the ones sent as
+// strings to keep their precision
+func isNumber(item interface{}, typeName string) bool {
+	switch item.(type) {
+	case int64, uint64, float64, int, float32:
+		return true
+	case string:
+		return numericTypes[baseType(typeName)]
+	}
+
+	return false
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testResult() *Result {
+	return &Result{
+		Columns: []string{"id", "name", "price"},
+		ColumnTypes: []ColumnInfo{
+			{Name: "id", Type: "INT"},
+			{Name: "name", Type: "VARCHAR"},
+			{Name: "price", Type: "DECIMAL"},
+		},
+		Rows: []Row{
+			{int64(1), "plain", "9.99"},
+			{int64(2), "", nil},
+			{int64(3), "a,\"b\"\nc", "0.50"},
+		},
+	}
+}
+
+func TestResultCSV(t *testing.T) {
+	out := testResult().CSV(DefaultCSVOptions())
+
+	assert.Equal(t, "id,name,price\n1,plain,9.99\n2,,\n3,\"a,\"\"b\"\"\nc\",0.50\n", string(out))
+}
+
+func TestResultCSV_Values(t *testing.T) {
+	res := &Result{
+		Columns: []string{"a", "b", "c"},
+		Rows:    []Row{{json.RawMessage(`{"a":1}`), Binary{0xca, 0xfe}, " x"}},
+	}
+
+	assert.Equal(t, "a,b,c\n\"{\"\"a\"\":1}\",0xCAFE,\" x\"\n", string(res.CSV(DefaultCSVOptions())))
+}
+
+func TestResultCSV_Options(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   url.Values
+		expected string
+	}{
+		{
+			"delimiter",
+			url.Values{"delimiter": {";"}},
+			"id;name;price\n1;plain;9.99\n2;;\n3;\"a,\"\"b\"\"\nc\";0.50\n",
+		},
+		{
+			"null marker",
+			url.Values{"null": {`\N`}, "header": {"false"}},
+			"1,plain,9.99\n2,,\\N\n3,\"a,\"\"b\"\"\nc\",0.50\n",
+		},
+		{
+			"quote all",
+			url.Values{"quote": {"all"}, "header": {"false"}},
+			"\"1\",\"plain\",\"9.99\"\n\"2\",\"\",\n\"3\",\"a,\"\"b\"\"\nc\",\"0.50\"\n",
+		},
+		{
+			"quote non numeric",
+			url.Values{"quote": {"nonnumeric"}, "header": {"false"}},
+			"1,\"plain\",9.99\n2,\"\",\n3,\"a,\"\"b\"\"\nc\",0.50\n",
+		},
+		{
+			"quote none",
+			url.Values{"quote": {"none"}, "delimiter": {"tab"}, "null": {`\N`}, "header": {"false"}},
+			"1\tplain\t9.99\n2\t\t\\N\n3\ta,\"b\"\\nc\t0.50\n",
+		},
+		{
+			"crlf and bom",
+			url.Values{"line_ending": {"crlf"}, "bom": {"true"}},
+			"\ufeffid,name,price\r\n1,plain,9.99\r\n2,,\r\n3,\"a,\"\"b\"\"\nc\",0.50\r\n",
+		},
+	}
+
+	for _, test := range tests {
+		opts, err := parseCSVOptions(test.params, DefaultCSVOptions())
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.expected, string(testResult().CSV(opts)), test.name)
+	}
+}
+
+func TestResultCSV_NullLookalike(t *testing.T) {
+	res := &Result{Columns: []string{"a"}, Rows: []Row{{`\N`}, {nil}}}
+	opts := DefaultCSVOptions()
+	opts.Null = `\N`
+
+	assert.Equal(t, "a\n\"\\N\"\n\\N\n", string(res.CSV(opts)))
+
+	opts.Quote = QuoteNone
+	assert.Equal(t, "a\n\\\\N\n\\N\n", string(res.CSV(opts)))
+}
+
+func TestParseCSVOptions_Invalid(t *testing.T) {
+	invalid := []url.Values{
+		{"delimiter": {"ab"}},
+		{"delimiter": {`"`}},
+		{"quote": {"some"}},
+		{"quote": {"none"}, "delimiter": {`\`}},
+		{"header": {"maybe"}},
+		{"line_ending": {"cr"}},
+		{"bom": {"x"}},
+	}
+
+	for _, params := range invalid {
+		_, err := parseCSVOptions(params, DefaultCSVOptions())
+		assert.Error(t, err, params.Encode())
+	}
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	defaultDumpBatchSize = 100
+
+	// dumpDelimiter ends the statements defining routines
+	dumpDelimiter = ";;"
+)
+
+// DumpOptions controls what a dump holds
+type DumpOptions struct {
+	// Tables limits the dump to the given tables and views, routines being
+	// left out. Exclude leaves tables and views out.
+	Tables     []string
+	Exclude    []string
+	SchemaOnly bool
+	DataOnly   bool
+	Gzip       bool
+	// BatchSize is the number of rows per INSERT statement
+	BatchSize int
+}
+
+// includes reports whether the table or view is part of the dump
+func (opts DumpOptions) includes(name string) bool {
+	for _, excluded := range opts.Exclude {
+		if excluded == name {
+			return false
+		}
+	}
+
+	if len(opts.Tables) == 0 {
+		return true
+	}
+
+	for _, included := range opts.Tables {
+		if included == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dumper writes the dump of a database read on a single connection
+type dumper struct {
+	ctx      context.Context
+	conn     *sqlx.Conn
+	w        io.Writer
+	database string
+	opts     DumpOptions
+}
+
+// Dump writes a SQL script recreating the tables, views and routines of the
+// database along with the table data, the way mysqldump does. Everything is
+// read in a single transaction, so the data is consistent across tables
+// using InnoDB. The script doesn't qualify the names of the objects it
+// creates, but the definitions come from the server as is: view bodies
+// name their tables along with the dumped database, and views and routines
+// keep their DEFINER. Restoring into another database or server may require
+// editing them.
+func (client *Client) Dump(ctx context.Context, database string, w io.Writer, opts DumpOptions) error {
+	conn, err := client.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	entry := Query{Query: fmt.Sprintf("-- Dump of %s", quoteIdentifier(database)), Database: database, Origin: OriginUser}
+	start := time.Now()
+
+	for _, statement := range []string{MySQLDumpIsolation, MySQLDumpSnapshot} {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			client.recordExecution(entry, start, err)
+			return err
+		}
+	}
+	defer conn.ExecContext(context.Background(), MySQLRollbackTransaction)
+
+	d := &dumper{ctx: ctx, conn: conn, w: w, database: database, opts: opts}
+
+	err = d.dump()
+	client.recordExecution(entry, start, err)
+
+	return err
+}
+
+func (d *dumper) dump() error {
+	var version string
+	if err := d.conn.QueryRowxContext(d.ctx, MySQLVersion).Scan(&version); err != nil {
+		return err
+	}
+
+	header := fmt.Sprintf("-- Dump of %s\n-- Server version %s\n-- Date %s\n\n%s",
+		quoteIdentifier(d.database), version, time.Now().Format(time.RFC3339), MySQLDumpHeader)
+	if err := d.write(header); err != nil {
+		return err
+	}
+
+	tables, err := d.names(MySQLDatabaseTables, d.database)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		if !d.opts.includes(table) {
+			continue
+		}
+
+		if err := d.table(table); err != nil {
+			return fmt.Errorf("Table %s: %s", table, err)
+		}
+	}
+
+	if !d.opts.DataOnly {
+		views, err := d.names(MySQLDatabaseViews, d.database)
+		if err != nil {
+			return err
+		}
+
+		included := views[:0]
+		for _, view := range views {
+			if d.opts.includes(view) {
+				included = append(included, view)
+			}
+		}
+
+		// Views can select from views coming later, stand-ins with the same
+		// columns are created first so every definition can be restored
+		for _, view := range included {
+			if err := d.standIn(view); err != nil {
+				return fmt.Errorf("View %s: %s", view, err)
+			}
+		}
+
+		for _, view := range included {
+			if err := d.view(view); err != nil {
+				return fmt.Errorf("View %s: %s", view, err)
+			}
+		}
+
+		if len(d.opts.Tables) == 0 {
+			if err := d.routines("PROCEDURE", "Procedure", MySQLDatabaseProcedures); err != nil {
+				return err
+			}
+			if err := d.routines("FUNCTION", "Function", MySQLDatabaseFunctions); err != nil {
+				return err
+			}
+		}
+	}
+
+	return d.write("\n" + MySQLDumpFooter)
+}
+
+// table writes the structure and the data of a table
+func (d *dumper) table(table string) error {
+	if !d.opts.DataOnly {
+		// SHOW CREATE TABLE returns the name and the statement
+		definition, err := d.definition(fmt.Sprintf(MySQLShowCreateTable, quoteIdentifier(d.database), quoteIdentifier(table)), 1)
+		if err != nil {
+			return err
+		}
+
+		err = d.write(
+			d.section("Table", table),
+			fmt.Sprintf(MySQLDumpDropTable, quoteIdentifier(table)), "\n",
+			definition, ";\n",
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.opts.SchemaOnly {
+		return nil
+	}
+
+	return d.data(table)
+}
+
+// data writes the rows of a table as INSERT statements. Generated columns
+// are left out as they can't be inserted.
+func (d *dumper) data(table string) error {
+	columns, err := d.names(MySQLDumpColumns, d.database, table)
+	if err != nil {
+		return err
+	}
+
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteIdentifier(column)
+	}
+
+	rows, err := d.conn.QueryxContext(d.ctx, fmt.Sprintf(MySQLDumpSelect, strings.Join(quoted, ", "), qualifiedName(d.database, table)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+
+	cols := columnInfos(columnTypes)
+
+	batchSize := d.opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultDumpBatchSize
+	}
+
+	if err := d.write("\n-- Data of ", quoteIdentifier(table), "\n"); err != nil {
+		return err
+	}
+
+	writer := newSQLRowWriter(d.w, table, batchSize)
+	if err := writer.WriteColumns(cols); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		row, err := scanRow(rows, cols)
+		if err != nil {
+			return err
+		}
+
+		if err := writer.WriteRow(row); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return writer.Close(false, nil)
+}
+
+// standIn writes a placeholder for a view, replaced by its definition later
+// on, as mysqldump does
+func (d *dumper) standIn(view string) error {
+	columns, err := d.names(MySQLDumpColumns, d.database, view)
+	if err != nil {
+		return err
+	}
+
+	return d.write(d.section("Stand-in for view", view), standInView(view, columns), "\n")
+}
+
+// standInView returns the statements creating a view with the given columns
+// selecting constants
+func standInView(view string, columns []string) string {
+	selected := make([]string, len(columns))
+	for i, column := range columns {
+		selected[i] = "1 AS " + quoteIdentifier(column)
+	}
+
+	return fmt.Sprintf(MySQLDumpDropView, quoteIdentifier(view)) + "\n" +
+		fmt.Sprintf(MySQLDumpStandInView, quoteIdentifier(view), strings.Join(selected, ", "))
+}
+
+// view writes the definition of a view
+func (d *dumper) view(view string) error {
+	definition, err := d.definition(fmt.Sprintf(MySQLViewDefinition, quoteIdentifier(d.database), quoteIdentifier(view)), 1)
+	if err != nil {
+		return err
+	}
+
+	return d.write(
+		d.section("View", view),
+		fmt.Sprintf(MySQLDumpDropView, quoteIdentifier(view)), "\n",
+		definition, ";\n",
+	)
+}
+
+// routines writes the definition of the procedures or functions, within a
+// DELIMITER block as their body holds semicolons
+func (d *dumper) routines(routineType string, label string, listQuery string) error {
+	names, err := d.names(listQuery, d.database)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		// SHOW CREATE PROCEDURE returns the name, the sql_mode and the
+		// statement
+		definition, err := d.definition(fmt.Sprintf(MySQLProcedureDefinition, routineType, quoteIdentifier(d.database), quoteIdentifier(name)), 2)
+		if err != nil {
+			return fmt.Errorf("%s %s: %s", label, name, err)
+		}
+
+		err = d.write(
+			d.section(label, name),
+			fmt.Sprintf(MySQLDumpDropRoutine, routineType, quoteIdentifier(name)), "\n",
+			"DELIMITER ", dumpDelimiter, "\n",
+			definition, dumpDelimiter, "\n",
+			"DELIMITER ;\n",
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// section returns the comment introducing an object of the dump
+func (d *dumper) section(label string, name string) string {
+	return fmt.Sprintf("\n--\n-- %s %s\n--\n\n", label, quoteIdentifier(name))
+}
+
+// names returns the first column of the resultset
+func (d *dumper) names(query string, args ...interface{}) ([]string, error) {
+	rows, err := d.conn.QueryxContext(d.ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// definition returns the statement found in the given column of a SHOW
+// CREATE resultset
+func (d *dumper) definition(query string, column int) (string, error) {
+	rows, err := d.conn.QueryxContext(d.ctx, query)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		return "", errors.New("Definition not found")
+	}
+
+	values, err := rows.SliceScan()
+	if err != nil {
+		return "", err
+	}
+
+	if column >= len(values) || values[column] == nil {
+		return "", errors.New("Definition is not readable, check the privileges of the user")
+	}
+
+	return textValue(decodeValue(values[column], "TEXT")), nil
+}
+
+func (d *dumper) write(parts ...string) error {
+	for _, part := range parts {
+		if _, err := io.WriteString(d.w, part); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitNames reads a list of names given either as repeated parameters or
+// separated by commas
+func splitNames(values []string) []string {
+	var names []string
+
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// parseDumpOptions reads the tables, exclude, schema_only, data_only, gzip
+// and batch_size parameters
+func parseDumpOptions(params url.Values) (DumpOptions, error) {
+	opts := DumpOptions{
+		Tables:  splitNames(params["tables"]),
+		Exclude: splitNames(params["exclude"]),
+	}
+
+	flags := map[string]*bool{
+		"schema_only": &opts.SchemaOnly,
+		"data_only":   &opts.DataOnly,
+		"gzip":        &opts.Gzip,
+	}
+
+	for name, flag := range flags {
+		if value := params.Get(name); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return opts, fmt.Errorf("Invalid %s value %q", name, value)
+			}
+			*flag = parsed
+		}
+	}
+
+	if opts.SchemaOnly && opts.DataOnly {
+		return opts, errors.New("schema_only and data_only can't be both set")
+	}
+
+	if batchSize := params.Get("batch_size"); batchSize != "" {
+		var err error
+		opts.BatchSize, err = strconv.Atoi(batchSize)
+		if err != nil || opts.BatchSize <= 0 {
+			return opts, fmt.Errorf("Invalid batch size %q", batchSize)
+		}
+	}
+
+	return opts, nil
+}
+
+// APIDumpDatabase streams a SQL dump of the database as a file download.
+// As the status can't be changed once the body is sent, errors are reported
+// at the end of the file and in the X-Error trailer.
+func APIDumpDatabase(c *gin.Context) {
+	dbClient := getClient(c)
+	database := c.Params.ByName("database")
+
+	opts, err := parseDumpOptions(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	filename := safeFilename(database) + ".sql"
+	contentType := "application/sql; charset=utf-8"
+	if opts.Gzip {
+		filename += ".gz"
+		contentType = "application/gzip"
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Header("Trailer", "X-Error")
+
+	var w io.Writer = c.Writer
+	var gz *gzip.Writer
+	if opts.Gzip {
+		gz = gzip.NewWriter(c.Writer)
+		w = gz
+	}
+
+	err = dbClient.Dump(c.Request.Context(), database, w, opts)
+	if err != nil {
+		fmt.Fprintf(w, "\n-- Dump failed: %s\n", strings.ReplaceAll(err.Error(), "\n", " "))
+		c.Writer.Header().Set("X-Error", err.Error())
+	}
+
+	if gz != nil {
+		gz.Close()
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDumpOptions(t *testing.T) {
+	opts, err := parseDumpOptions(url.Values{
+		"tables":      {"users, orders", "items"},
+		"exclude":     {"logs"},
+		"schema_only": {"true"},
+		"gzip":        {"1"},
+		"batch_size":  {"50"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"users", "orders", "items"}, opts.Tables)
+	assert.Equal(t, []string{"logs"}, opts.Exclude)
+	assert.True(t, opts.SchemaOnly)
+	assert.False(t, opts.DataOnly)
+	assert.True(t, opts.Gzip)
+	assert.Equal(t, 50, opts.BatchSize)
+}
+
+func TestParseDumpOptions_Invalid(t *testing.T) {
+	invalid := []url.Values{
+		{"schema_only": {"true"}, "data_only": {"true"}},
+		{"gzip": {"maybe"}},
+		{"batch_size": {"-1"}},
+	}
+
+	for _, params := range invalid {
+		_, err := parseDumpOptions(params)
+		assert.Error(t, err, params.Encode())
+	}
+}
+
+func TestDumpOptionsIncludes(t *testing.T) {
+	all := DumpOptions{Exclude: []string{"logs"}}
+	assert.True(t, all.includes("users"))
+	assert.False(t, all.includes("logs"))
+
+	some := DumpOptions{Tables: []string{"users", "logs"}, Exclude: []string{"logs"}}
+	assert.True(t, some.includes("users"))
+	assert.False(t, some.includes("orders"))
+	assert.False(t, some.includes("logs"))
+}
+
+func TestDumpSection_Restorable(t *testing.T) {
+	d := &dumper{}
+	script := d.section("Procedure", "p") +
+		"DROP PROCEDURE IF EXISTS `p`;\n" +
+		"DELIMITER " + dumpDelimiter + "\n" +
+		"CREATE PROCEDURE `p`() BEGIN SELECT 1; SELECT 2; END" + dumpDelimiter + "\n" +
+		"DELIMITER ;\n"
+
+	statements, err := splitStatements(script)
+	assert.NoError(t, err)
+	assert.Len(t, statements, 2)
+	assert.Equal(t, "CREATE PROCEDURE `p`() BEGIN SELECT 1; SELECT 2; END", statements[1].SQL)
+}
+
+func TestStandInView(t *testing.T) {
+	script := standInView("v`1", []string{"id", "total amount"})
+
+	assert.Equal(t, "DROP VIEW IF EXISTS `v``1`;\nCREATE VIEW `v``1` AS SELECT 1 AS `id`, 1 AS `total amount`;", script)
+
+	statements, err := splitStatements(script)
+	assert.NoError(t, err)
+	assert.Len(t, statements, 2)
+}
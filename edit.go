@@ -0,0 +1,551 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrNoUniqueKey is returned when editing a table whose rows can't be
+	// identified
+	ErrNoUniqueKey = errors.New("Table has no primary or unique key, its rows can't be edited")
+
+	// ErrRowChanged is returned when the edited row was changed or deleted
+	// since it was read
+	ErrRowChanged = errors.New("Row was changed or deleted since it was read, reload the data")
+)
+
+// uncomparableTypes are the approximate column types left out of the
+// optimistic concurrency check, as their values don't survive the round
+// trip. Binary columns are left out too, see binaryTypes, as results hold
+// them truncated.
+var uncomparableTypes = map[string]bool{
+	"FLOAT":  true,
+	"DOUBLE": true,
+	"REAL":   true,
+}
+
+// RowChange describes an edited row. Key holds the values of the columns of
+// the key identifying the row and Original the values read before editing,
+// which must still be the same for the change to be applied. Values holds
+// the new values of the updated or inserted cells, nil being NULL.
+type RowChange struct {
+	Key      map[string]interface{} `json:"key"`
+	Original map[string]interface{} `json:"original,omitempty"`
+	Values   map[string]interface{} `json:"values,omitempty"`
+}
+
+// EditResult is the outcome of a row edit
+type EditResult struct {
+	RowsAffected int64 `json:"rows_affected"`
+	LastInsertID int64 `json:"last_insert_id,omitempty"`
+}
+
+// rowEditor builds the statements editing the rows of a table
+type rowEditor struct {
+	table   string
+	columns []TableColumn
+	byName  map[string]TableColumn
+	// key lists the columns identifying a row
+	key []string
+}
+
+func newRowEditor(database string, table string, columns []TableColumn, key []string) *rowEditor {
+	editor := &rowEditor{
+		table:   qualifiedName(database, table),
+		columns: columns,
+		byName:  make(map[string]TableColumn, len(columns)),
+		key:     key,
+	}
+
+	for _, column := range columns {
+		editor.byName[column.Name] = column
+	}
+
+	return editor
+}
+
+// TableRowKey returns the columns identifying the rows of the table: the
+// primary key, or else the first unique index made of NOT NULL columns
+func (client *Client) TableRowKey(database string, table string, columns []TableColumn) ([]string, error) {
+	res, err := client.Query(MySQLTableUniqueKeys, database, table)
+	if err != nil {
+		return nil, err
+	}
+
+	nullable := map[string]bool{}
+	for _, column := range columns {
+		nullable[column.Name] = column.Nullable
+	}
+
+	var indexes []string
+	keys := map[string][]string{}
+	for _, row := range res.Rows {
+		index, column := textValue(row[0]), textValue(row[1])
+
+		if _, ok := keys[index]; !ok {
+			indexes = append(indexes, index)
+		}
+		keys[index] = append(keys[index], column)
+	}
+
+	// NULL values are not unique, rows having one can't be told apart
+	for _, index := range indexes {
+		usable := true
+		for _, column := range keys[index] {
+			if nullable[column] {
+				usable = false
+			}
+		}
+
+		if usable {
+			return keys[index], nil
+		}
+	}
+
+	return nil, ErrNoUniqueKey
+}
+
+// editArg converts a JSON value to the argument bound for the column
+func editArg(value interface{}, column TableColumn) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	}
+
+	return filterArg(value, column)
+}
+
+// orderedNames returns the names of the values in table order, failing on
+// unknown columns
+func (e *rowEditor) orderedNames(values map[string]interface{}) ([]string, error) {
+	for name := range values {
+		if _, ok := e.byName[name]; !ok {
+			return nil, fmt.Errorf("Unknown column %s", name)
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for _, column := range e.columns {
+		if _, ok := values[column.Name]; ok {
+			names = append(names, column.Name)
+		}
+	}
+
+	return names, nil
+}
+
+// condition matches the row by its key and, when given, its original values
+func (e *rowEditor) condition(change RowChange) (string, []interface{}, error) {
+	if len(change.Key) != len(e.key) {
+		return "", nil, fmt.Errorf("Key must hold exactly the columns %s", strings.Join(e.key, ", "))
+	}
+
+	var conditions []string
+	var args []interface{}
+
+	for _, name := range e.key {
+		value, ok := change.Key[name]
+		if !ok || value == nil {
+			return "", nil, fmt.Errorf("Missing value for key column %s", name)
+		}
+
+		arg, err := editArg(value, e.byName[name])
+		if err != nil {
+			return "", nil, err
+		}
+
+		conditions = append(conditions, quoteIdentifier(name)+" = ?")
+		args = append(args, arg)
+	}
+
+	names, err := e.orderedNames(change.Original)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, name := range names {
+		column := e.byName[name]
+		if uncomparableTypes[baseType(column.DataType)] || binaryTypes[baseType(column.DataType)] {
+			continue
+		}
+
+		arg, err := editArg(change.Original[name], column)
+		if err != nil {
+			return "", nil, err
+		}
+
+		placeholder := "?"
+		if baseType(column.DataType) == "JSON" && arg != nil {
+			placeholder = "CAST(? AS JSON)"
+		}
+
+		conditions = append(conditions, quoteIdentifier(name)+" <=> "+placeholder)
+		args = append(args, arg)
+	}
+
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// insert builds the statement inserting a row with the values
+func (e *rowEditor) insert(values map[string]interface{}) (string, []interface{}, error) {
+	names, err := e.orderedNames(values)
+	if err != nil {
+		return "", nil, err
+	}
+
+	quoted := make([]string, len(names))
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdentifier(name)
+
+		args[i], err = editArg(values[name], e.byName[name])
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ") + ")"
+
+	return fmt.Sprintf(MySQLInsertRows, e.table, strings.Join(quoted, ", "), placeholders), args, nil
+}
+
+// update builds the statement setting the values of the row
+func (e *rowEditor) update(change RowChange) (string, []interface{}, error) {
+	names, err := e.orderedNames(change.Values)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(names) == 0 {
+		return "", nil, errors.New("No value to update")
+	}
+
+	assignments := make([]string, len(names))
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		assignments[i] = quoteIdentifier(name) + " = ?"
+
+		args[i], err = editArg(change.Values[name], e.byName[name])
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	condition, conditionArgs, err := e.condition(change)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return fmt.Sprintf(MySQLUpdateRow, e.table, strings.Join(assignments, ", "), condition), append(args, conditionArgs...), nil
+}
+
+// remove builds the statement deleting the row
+func (e *rowEditor) remove(change RowChange) (string, []interface{}, error) {
+	condition, args, err := e.condition(change)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return fmt.Sprintf(MySQLDeleteRow, e.table, condition), args, nil
+}
+
+// lock builds the statement locking the row, reading nothing when it
+// changed since it was read
+func (e *rowEditor) lock(change RowChange) (string, []interface{}, error) {
+	condition, args, err := e.condition(change)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return fmt.Sprintf(MySQLLockRow, e.table, condition), args, nil
+}
+
+// rowEditor returns the editor of the table, failing when its rows can't be
+// identified
+func (client *Client) rowEditor(database string, table string) (*rowEditor, error) {
+	columns, err := client.TableColumnList(database, table)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := client.TableRowKey(database, table, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRowEditor(database, table, columns, key), nil
+}
+
+// InsertRow inserts a row, the columns left out getting their default value
+func (client *Client) InsertRow(ctx context.Context, database string, table string, values map[string]interface{}) (*EditResult, error) {
+	editor, err := client.rowEditor(database, table)
+	if err != nil {
+		return nil, err
+	}
+
+	query, args, err := editor.insert(values)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &EditResult{}
+
+	err = client.runEdit(ctx, func(ctx context.Context, execer editExecer) error {
+		entry := Query{Query: query, Origin: OriginUser}
+		start := time.Now()
+
+		res, err := execer.ExecContext(ctx, query, args...)
+		if err != nil {
+			client.recordExecution(entry, start, err)
+			return err
+		}
+
+		result.RowsAffected, _ = res.RowsAffected()
+		result.LastInsertID, _ = res.LastInsertId()
+
+		entry.RowsAffected = result.RowsAffected
+		client.recordExecution(entry, start, nil)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// UpdateRow sets the values of a row, provided it still holds its original
+// values
+func (client *Client) UpdateRow(ctx context.Context, database string, table string, change RowChange) (*EditResult, error) {
+	editor, err := client.rowEditor(database, table)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.editRows(ctx, editor, []RowChange{change}, editor.update)
+}
+
+// DeleteRows deletes the rows, provided they all still hold their original
+// values. Either every row is deleted or none.
+func (client *Client) DeleteRows(ctx context.Context, database string, table string, changes []RowChange) (*EditResult, error) {
+	if len(changes) == 0 {
+		return nil, errors.New("No row to delete")
+	}
+
+	editor, err := client.rowEditor(database, table)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.editRows(ctx, editor, changes, editor.remove)
+}
+
+// editExecer runs the statements of an edit: a transaction of its own or
+// the session connection, within the transaction opened by the user
+type editExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// runEdit calls fn in a transaction, so its statements are applied all or
+// none. While the user has a transaction open on the session, fn runs in it
+// behind a savepoint: the edit is then committed or rolled back along with
+// the rest of the transaction, and doesn't wait on the locks it holds. The
+// edit is refused if that transaction ends before it runs, rather than being
+// committed on its own.
+func (client *Client) runEdit(ctx context.Context, fn func(ctx context.Context, execer editExecer) error) error {
+	if !client.InTransaction() {
+		return client.runEditTx(ctx, fn)
+	}
+
+	return client.withSession(ctx, func(ctx context.Context, conn *sqlx.Conn, threadID int64) error {
+		if !client.InTransaction() {
+			return ErrNoTransaction
+		}
+
+		if _, err := conn.ExecContext(ctx, MySQLSavepointEdit); err != nil {
+			return err
+		}
+
+		if err := fn(ctx, conn); err != nil {
+			conn.ExecContext(ctx, MySQLRollbackEdit)
+			return err
+		}
+
+		_, err := conn.ExecContext(ctx, MySQLReleaseEdit)
+		return err
+	})
+}
+
+// runEditTx calls fn in a transaction of its own on a pool connection
+func (client *Client) runEditTx(ctx context.Context, fn func(ctx context.Context, execer editExecer) error) error {
+	tx, err := client.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// editRows applies the statements built by edit in a transaction. Each row is
+// locked first, ErrRowChanged being returned when it doesn't match anymore,
+// as the affected row count doesn't tell a missing row from an unchanged one.
+func (client *Client) editRows(ctx context.Context, editor *rowEditor, changes []RowChange, edit func(RowChange) (string, []interface{}, error)) (*EditResult, error) {
+	result := &EditResult{}
+
+	err := client.runEdit(ctx, func(ctx context.Context, execer editExecer) error {
+		for _, change := range changes {
+			if err := lockRow(ctx, execer, editor, change); err != nil {
+				return err
+			}
+
+			query, args, err := edit(change)
+			if err != nil {
+				return err
+			}
+
+			entry := Query{Query: query, Origin: OriginUser}
+			start := time.Now()
+
+			res, err := execer.ExecContext(ctx, query, args...)
+			if err != nil {
+				client.recordExecution(entry, start, err)
+				return err
+			}
+
+			entry.RowsAffected, _ = res.RowsAffected()
+			result.RowsAffected += entry.RowsAffected
+
+			client.recordExecution(entry, start, nil)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// lockRow locks the row of the change, failing with ErrRowChanged when it
+// can't be found
+func lockRow(ctx context.Context, execer editExecer, editor *rowEditor, change RowChange) error {
+	query, args, err := editor.lock(change)
+	if err != nil {
+		return err
+	}
+
+	rows, err := execer.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return ErrRowChanged
+	}
+
+	return nil
+}
+
+// bindEdit decodes the JSON body, keeping numbers as they are written
+func bindEdit(c *gin.Context, target interface{}) error {
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.UseNumber()
+
+	if err := decoder.Decode(target); err != nil {
+		return errors.New("Invalid JSON body")
+	}
+
+	return nil
+}
+
+// editStatus returns the status of a failed edit
+func editStatus(err error) int {
+	if err == ErrRowChanged || err == ErrNoTransaction || err == ErrTransactionLost {
+		return http.StatusConflict
+	}
+
+	return http.StatusBadRequest
+}
+
+// APIInsertRow inserts a row, the body being a RowChange holding the values
+func APIInsertRow(c *gin.Context) {
+	var change RowChange
+	if err := bindEdit(c, &change); err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	result, err := getClient(c).InsertRow(c.Request.Context(), c.Params.ByName("database"), c.Params.ByName("table"), change.Values)
+	if err != nil {
+		c.JSON(editStatus(err), NewError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// APIUpdateRow updates the cells of a row, the body being a RowChange. It
+// fails with 409 when the row changed since it was read.
+func APIUpdateRow(c *gin.Context) {
+	var change RowChange
+	if err := bindEdit(c, &change); err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	result, err := getClient(c).UpdateRow(c.Request.Context(), c.Params.ByName("database"), c.Params.ByName("table"), change)
+	if err != nil {
+		c.JSON(editStatus(err), NewError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// APIDeleteRows deletes rows, the body holding the RowChange of each one in
+// a rows array. It fails with 409 when one of them changed since it was
+// read, nothing being deleted.
+func APIDeleteRows(c *gin.Context) {
+	var body struct {
+		Rows []RowChange `json:"rows"`
+	}
+	if err := bindEdit(c, &body); err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	result, err := getClient(c).DeleteRows(c.Request.Context(), c.Params.ByName("database"), c.Params.ByName("table"), body.Rows)
+	if err != nil {
+		c.JSON(editStatus(err), NewError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testRowEditor() *rowEditor {
+	columns := []TableColumn{
+		{Name: "id", DataType: "int"},
+		{Name: "name", DataType: "varchar", Nullable: true},
+		{Name: "score", DataType: "double"},
+		{Name: "meta", DataType: "json", Nullable: true},
+	}
+
+	return newRowEditor("app", "users", columns, []string{"id"})
+}
+
+func TestRowEditorInsert(t *testing.T) {
+	query, args, err := testRowEditor().insert(map[string]interface{}{
+		"meta": map[string]interface{}{"a": json.Number("1")},
+		"name": "Ana",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "INSERT INTO `app`.`users` (`name`, `meta`) VALUES (?, ?)", query)
+	assert.Equal(t, []interface{}{"Ana", `{"a":1}`}, args)
+
+	query, args, err = testRowEditor().insert(nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "INSERT INTO `app`.`users` () VALUES ()", query)
+	assert.Empty(t, args)
+}
+
+func TestRowEditorUpdate(t *testing.T) {
+	query, args, err := testRowEditor().update(RowChange{
+		Key:      map[string]interface{}{"id": json.Number("7")},
+		Original: map[string]interface{}{"name": nil, "score": 1.5, "meta": `{"a": 1}`},
+		Values:   map[string]interface{}{"name": "Bob", "score": nil},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "UPDATE `app`.`users` SET `name` = ?, `score` = ? WHERE `id` = ? AND `name` <=> ? AND `meta` <=> CAST(? AS JSON) LIMIT 1", query)
+	assert.Equal(t, []interface{}{"Bob", nil, "7", nil, `{"a": 1}`}, args)
+}
+
+func TestRowEditorRemove(t *testing.T) {
+	query, args, err := testRowEditor().remove(RowChange{Key: map[string]interface{}{"id": "7"}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "DELETE FROM `app`.`users` WHERE `id` = ? LIMIT 1", query)
+	assert.Equal(t, []interface{}{"7"}, args)
+}
+
+func TestRowEditor_Invalid(t *testing.T) {
+	editor := testRowEditor()
+
+	_, _, err := editor.update(RowChange{Key: map[string]interface{}{"id": "7"}})
+	assert.Error(t, err)
+
+	_, _, err = editor.update(RowChange{Key: map[string]interface{}{"id": "7"}, Values: map[string]interface{}{"missing": "x"}})
+	assert.Error(t, err)
+
+	_, _, err = editor.remove(RowChange{Key: map[string]interface{}{"name": "7"}})
+	assert.Error(t, err)
+
+	_, _, err = editor.remove(RowChange{Key: map[string]interface{}{"id": nil}})
+	assert.Error(t, err)
+
+	_, _, err = editor.remove(RowChange{Key: map[string]interface{}{"id": "7", "name": "x"}})
+	assert.Error(t, err)
+}
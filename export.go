@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// exportFormat describes a format query results can be downloaded as
+type exportFormat struct {
+	contentType string
+	extension   string
+	newWriter   func(w io.Writer, opts exportOptions) RowWriter
+}
+
+// exportOptions are the parameters of an export
+type exportOptions struct {
+	// Table is used in the file name and in the INSERT statements of the
+	// sql format
+	Table string
+	// CSV applies to the csv and tsv formats
+	CSV CSVOptions
+}
+
+// exportFormats are the formats accepted in the format parameter of queries
+var exportFormats = map[string]exportFormat{
+	"csv":      {"text/csv; charset=utf-8", ".csv", func(w io.Writer, opts exportOptions) RowWriter { return newCSVRowWriter(w, opts.CSV) }},
+	"tsv":      {"text/tab-separated-values; charset=utf-8", ".tsv", func(w io.Writer, opts exportOptions) RowWriter { return newCSVRowWriter(w, opts.CSV) }},
+	"json":     {"application/json; charset=utf-8", ".json", func(w io.Writer, _ exportOptions) RowWriter { return newJSONArrayRowWriter(w, false) }},
+	"ndjson":   {"application/x-ndjson", ".ndjson", func(w io.Writer, _ exportOptions) RowWriter { return newJSONArrayRowWriter(w, true) }},
+	"markdown": {"text/markdown; charset=utf-8", ".md", func(w io.Writer, _ exportOptions) RowWriter { return newMarkdownRowWriter(w) }},
+	"sql":      {"application/sql; charset=utf-8", ".sql", func(w io.Writer, opts exportOptions) RowWriter { return newSQLRowWriter(w, opts.Table, sqlBatchSize) }},
+}
+
+// parseExportOptions reads the parameters of the named format
+func parseExportOptions(name string, params url.Values) (exportOptions, error) {
+	defaults := DefaultCSVOptions()
+	if name == "tsv" {
+		defaults.Delimiter = '\t'
+	}
+
+	csvOptions, err := parseCSVOptions(params, defaults)
+	if err != nil {
+		return exportOptions{}, err
+	}
+
+	return exportOptions{Table: params.Get("table"), CSV: csvOptions}, nil
+}
+
+// sqlBatchSize is the number of rows per INSERT statement of SQL exports
+const sqlBatchSize = 100
+
+// exportRowWriter sends the output of a format writer as a file download. As
+// the status can't be changed once the body is sent, truncation and errors
+// are reported in the X-Truncated and X-Error trailers.
+type exportRowWriter struct {
+	w        http.ResponseWriter
+	format   exportFormat
+	filename string
+	writer   RowWriter
+}
+
+// newExportRowWriter returns the writer for the named format
+func newExportRowWriter(w http.ResponseWriter, name string, opts exportOptions) (*exportRowWriter, error) {
+	format, ok := exportFormats[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown format %q", name)
+	}
+
+	if name == "sql" && opts.Table == "" {
+		return nil, fmt.Errorf("Table parameter is required for the sql format")
+	}
+
+	filename := "result"
+	if opts.Table != "" {
+		filename = safeFilename(opts.Table)
+	}
+
+	return &exportRowWriter{
+		w:        w,
+		format:   format,
+		filename: filename + format.extension,
+		writer:   format.newWriter(w, opts),
+	}, nil
+}
+
+func (ew *exportRowWriter) WriteColumns(columns []ColumnInfo) error {
+	ew.w.Header().Set("Content-Type", ew.format.contentType)
+	ew.w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": ew.filename}))
+	ew.w.Header().Set("Trailer", "X-Truncated, X-Error")
+
+	return ew.writer.WriteColumns(columns)
+}
+
+func (ew *exportRowWriter) WriteRow(row Row) error {
+	return ew.writer.WriteRow(row)
+}
+
+func (ew *exportRowWriter) Close(truncated bool, err error) error {
+	closeErr := ew.writer.Close(truncated, err)
+
+	ew.w.Header().Set("X-Truncated", strconv.FormatBool(truncated))
+	if err != nil {
+		ew.w.Header().Set("X-Error", err.Error())
+	}
+
+	return closeErr
+}
+
+// jsonArrayRowWriter writes each row as an object keyed by column name,
+// either in a JSON array or one per line (NDJSON)
+type jsonArrayRowWriter struct {
+	w       io.Writer
+	keys    [][]byte
+	rows    int
+	newline bool
+}
+
+func newJSONArrayRowWriter(w io.Writer, newline bool) *jsonArrayRowWriter {
+	return &jsonArrayRowWriter{w: w, newline: newline}
+}
+
+func (jw *jsonArrayRowWriter) WriteColumns(columns []ColumnInfo) error {
+	jw.keys = make([][]byte, len(columns))
+
+	for i, column := range columns {
+		key, err := json.Marshal(column.Name)
+		if err != nil {
+			return err
+		}
+		jw.keys[i] = key
+	}
+
+	if jw.newline {
+		return nil
+	}
+
+	_, err := io.WriteString(jw.w, "[")
+	return err
+}
+
+func (jw *jsonArrayRowWriter) WriteRow(row Row) error {
+	var b strings.Builder
+
+	if !jw.newline {
+		if jw.rows > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("{")
+	for i, item := range row {
+		// Exports hold the whole value, not the preview shown in the grid
+		if binary, ok := item.(Binary); ok {
+			item = binary.String()
+		}
+
+		value, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.Write(jw.keys[i])
+		b.WriteString(":")
+		b.Write(value)
+	}
+	b.WriteString("}")
+
+	if jw.newline {
+		b.WriteString("\n")
+	}
+
+	jw.rows++
+
+	_, err := io.WriteString(jw.w, b.String())
+	return err
+}
+
+func (jw *jsonArrayRowWriter) Close(truncated bool, err error) error {
+	if jw.newline {
+		return nil
+	}
+
+	_, err = io.WriteString(jw.w, "\n]\n")
+	return err
+}
+
+// markdownRowWriter writes the resultset as a Markdown table
+type markdownRowWriter struct {
+	w io.Writer
+}
+
+func newMarkdownRowWriter(w io.Writer) *markdownRowWriter {
+	return &markdownRowWriter{w: w}
+}
+
+func (mw *markdownRowWriter) WriteColumns(columns []ColumnInfo) error {
+	cells := make([]string, len(columns))
+	separators := make([]string, len(columns))
+
+	for i, column := range columns {
+		cells[i] = markdownCell(column.Name)
+		separators[i] = "---"
+	}
+
+	return mw.write(cells, separators)
+}
+
+func (mw *markdownRowWriter) WriteRow(row Row) error {
+	cells := make([]string, len(row))
+
+	for i, item := range row {
+		if item == nil {
+			cells[i] = "NULL"
+			continue
+		}
+		cells[i] = markdownCell(textValue(item))
+	}
+
+	return mw.write(cells)
+}
+
+func (mw *markdownRowWriter) Close(truncated bool, err error) error {
+	return nil
+}
+
+func (mw *markdownRowWriter) write(lines ...[]string) error {
+	for _, cells := range lines {
+		if _, err := io.WriteString(mw.w, "| "+strings.Join(cells, " | ")+" |\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// markdownCell escapes the characters breaking a table cell. Line breaks
+// can't be part of a cell and are turned into <br>.
+func markdownCell(text string) string {
+	replacer := strings.NewReplacer(
+		"\\", "\\\\",
+		"|", "\\|",
+		"\r\n", "<br>",
+		"\n", "<br>",
+		"\r", "<br>",
+	)
+
+	return replacer.Replace(text)
+}
+
+// sqlRowWriter writes the resultset as INSERT statements into table, each
+// holding up to batchSize rows
+type sqlRowWriter struct {
+	w         io.Writer
+	table     string
+	batchSize int
+	header    string
+	types     []string
+	inBatch   int
+}
+
+func newSQLRowWriter(w io.Writer, table string, batchSize int) *sqlRowWriter {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	return &sqlRowWriter{w: w, table: table, batchSize: batchSize}
+}
+
+func (sw *sqlRowWriter) WriteColumns(columns []ColumnInfo) error {
+	names := make([]string, len(columns))
+	sw.types = make([]string, len(columns))
+
+	for i, column := range columns {
+		names[i] = quoteIdentifier(column.Name)
+		sw.types[i] = column.Type
+	}
+
+	sw.header = fmt.Sprintf("INSERT INTO %s (%s) VALUES\n", quoteIdentifier(sw.table), strings.Join(names, ", "))
+
+	return nil
+}
+
+func (sw *sqlRowWriter) WriteRow(row Row) error {
+	values := make([]string, len(row))
+	for i, item := range row {
+		values[i] = sqlLiteral(item, sw.types[i])
+	}
+
+	prefix := ",\n"
+	if sw.inBatch == 0 {
+		prefix = sw.header
+	}
+
+	if _, err := io.WriteString(sw.w, prefix+"("+strings.Join(values, ", ")+")"); err != nil {
+		return err
+	}
+
+	sw.inBatch++
+	if sw.inBatch == sw.batchSize {
+		return sw.endStatement()
+	}
+
+	return nil
+}
+
+func (sw *sqlRowWriter) Close(truncated bool, err error) error {
+	if sw.inBatch > 0 {
+		return sw.endStatement()
+	}
+
+	return nil
+}
+
+func (sw *sqlRowWriter) endStatement() error {
+	sw.inBatch = 0
+
+	_, err := io.WriteString(sw.w, ";\n")
+	return err
+}
+
+// numericTypes are the column types whose values can be written unquoted
+var numericTypes = map[string]bool{
+	"TINYINT":   true,
+	"SMALLINT":  true,
+	"MEDIUMINT": true,
+	"INT":       true,
+	"INTEGER":   true,
+	"BIGINT":    true,
+	"DECIMAL":   true,
+	"FLOAT":     true,
+	"DOUBLE":    true,
+	"YEAR":      true,
+}
+
+// sqlLiteral formats a value as a MySQL literal. Numbers sent as strings to
+// keep their precision, e.g. DECIMAL, are written unquoted.
+func sqlLiteral(item interface{}, typeName string) string {
+	switch value := item.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case uint64:
+		return strconv.FormatUint(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	case Binary:
+		if len(value) == 0 {
+			return "''"
+		}
+		return encodeBinary(value, BinaryHex)
+	case string:
+		if numericTypes[baseType(typeName)] {
+			if _, err := strconv.ParseFloat(value, 64); err == nil {
+				return value
+			}
+		}
+	}
+
+	return quoteString(textValue(item))
+}
+
+// quoteString quotes a string literal, escaping it the way mysqldump does
+func quoteString(text string) string {
+	replacer := strings.NewReplacer(
+		"\\", "\\\\",
+		"'", "\\'",
+		"\x00", "\\0",
+		"\n", "\\n",
+		"\r", "\\r",
+		"\x1a", "\\Z",
+	)
+
+	return "'" + replacer.Replace(text) + "'"
+}
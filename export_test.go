@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportRowWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writer, err := newExportRowWriter(rec, "csv", exportOptions{Table: "users", CSV: DefaultCSVOptions()})
+	assert.NoError(t, err)
+
+	writeRows(writer, []Row{{1, "a,b"}, {2, nil}}, true, errors.New("connection lost"))
+
+	assert.Equal(t, "id,name\n1,\"a,b\"\n2,\n", rec.Body.String())
+	assert.Equal(t, `attachment; filename=users.csv`, rec.Header().Get("Content-Disposition"))
+	assert.Equal(t, "true", rec.Header().Get("X-Truncated"))
+	assert.Equal(t, "connection lost", rec.Header().Get("X-Error"))
+}
+
+func TestExportRowWriter_Invalid(t *testing.T) {
+	_, err := newExportRowWriter(httptest.NewRecorder(), "xml", exportOptions{})
+	assert.Error(t, err)
+
+	_, err = newExportRowWriter(httptest.NewRecorder(), "sql", exportOptions{})
+	assert.Error(t, err)
+}
+
+func TestTSVRowWriter(t *testing.T) {
+	opts, err := parseExportOptions("tsv", url.Values{})
+	assert.NoError(t, err)
+
+	buff := &bytes.Buffer{}
+	writeRows(newCSVRowWriter(buff, opts.CSV), []Row{{1, "a\tb"}, {2, "c"}}, false, nil)
+
+	assert.Equal(t, "id\tname\n1\t\"a\tb\"\n2\tc\n", buff.String())
+}
+
+func TestJSONArrayRowWriter(t *testing.T) {
+	buff := &bytes.Buffer{}
+	writeRows(newJSONArrayRowWriter(buff, false), []Row{{1, "a"}, {2, nil}}, false, nil)
+
+	var out []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buff.Bytes(), &out))
+	assert.Equal(t, []map[string]interface{}{
+		{"id": float64(1), "name": "a"},
+		{"id": float64(2), "name": nil},
+	}, out)
+}
+
+func TestJSONArrayRowWriter_Empty(t *testing.T) {
+	buff := &bytes.Buffer{}
+	writeRows(newJSONArrayRowWriter(buff, false), nil, false, nil)
+
+	assert.JSONEq(t, "[]", buff.String())
+}
+
+func TestNDJSONRowWriter(t *testing.T) {
+	buff := &bytes.Buffer{}
+	writeRows(newJSONArrayRowWriter(buff, true), []Row{{1, "a"}, {2, nil}}, false, nil)
+
+	assert.Equal(t, "{\"id\":1,\"name\":\"a\"}\n{\"id\":2,\"name\":null}\n", buff.String())
+}
+
+func TestJSONArrayRowWriter_Binary(t *testing.T) {
+	defer func(preview int) { options.BlobPreview = preview }(options.BlobPreview)
+	options.BlobPreview = 4
+
+	buff := &bytes.Buffer{}
+	writeRows(newJSONArrayRowWriter(buff, true), []Row{{1, Binary{1, 2, 3, 4, 5, 6, 7, 8}}}, false, nil)
+
+	assert.Equal(t, "{\"id\":1,\"name\":\"0x0102030405060708\"}\n", buff.String())
+}
+
+func TestMarkdownRowWriter(t *testing.T) {
+	buff := &bytes.Buffer{}
+	writeRows(newMarkdownRowWriter(buff), []Row{{1, "a|b\nc"}, {2, nil}}, false, nil)
+
+	expected := "| id | name |\n" +
+		"| --- | --- |\n" +
+		"| 1 | a\\|b<br>c |\n" +
+		"| 2 | NULL |\n"
+	assert.Equal(t, expected, buff.String())
+}
+
+func TestSQLRowWriter(t *testing.T) {
+	buff := &bytes.Buffer{}
+	writer := newSQLRowWriter(buff, "users", 2)
+	writeRows(writer, []Row{{int64(1), "it's"}, {int64(2), nil}, {int64(3), "a\\b\n"}}, false, nil)
+
+	expected := "INSERT INTO `users` (`id`, `name`) VALUES\n" +
+		"(1, 'it\\'s'),\n" +
+		"(2, NULL);\n" +
+		"INSERT INTO `users` (`id`, `name`) VALUES\n" +
+		"(3, 'a\\\\b\\n');\n"
+	assert.Equal(t, expected, buff.String())
+}
+
+func TestSQLLiteral(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		typeName string
+		expected string
+	}{
+		{nil, "INT", "NULL"},
+		{int64(-5), "INT", "-5"},
+		{uint64(7), "BIT", "7"},
+		{1.5, "DOUBLE", "1.5"},
+		{"12345678901234567890.5", "DECIMAL", "12345678901234567890.5"},
+		{"18446744073709551615", "UNSIGNED BIGINT", "18446744073709551615"},
+		{"2024-03-01T10:20:30", "DATETIME", "'2024-03-01T10:20:30'"},
+		{"1; DROP TABLE x", "DECIMAL", "'1; DROP TABLE x'"},
+		{json.RawMessage(`{"a":"b"}`), "JSON", `'{"a":"b"}'`},
+		{Binary{0xca, 0xfe}, "BLOB", "0xCAFE"},
+		{Binary{}, "BLOB", "''"},
+		{"\x00\x1a\r", "VARCHAR", `'\0\Z\r'`},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, sqlLiteral(test.value, test.typeName))
+	}
+}
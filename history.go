@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// Status of the queries of the history
+const (
+	HistorySuccess = "success"
+	HistoryError   = "error"
+)
+
+// Origins of the queries of the history
+const (
+	// OriginUser marks the queries written or triggered by the user
+	OriginUser = "user"
+	// OriginInternal marks the queries run by the application on its own,
+	// e.g. to list databases or read table metadata
+	OriginInternal = "internal"
+)
+
+const defaultHistoryLimit = 100
+
+// history holds the queries executed by all the clients, nil when disabled
+var history *HistoryStore
+
+// HistoryFilter selects entries of the history. Host and User are always
+// matched, Database and Text only when set. Before returns the entries
+// older than the given entry ID, to read the history page by page, and
+// Since the ones run at or after the given Unix time. Internal queries are
+// left out unless Internal is set.
+type HistoryFilter struct {
+	Host     string
+	User     string
+	Database string
+	Text     string
+	Before   int64
+	Since    int64
+	Limit    int
+	Internal bool
+}
+
+// matches reports whether the entry is selected by the filter
+func (filter HistoryFilter) matches(entry Query) bool {
+	if entry.Host != filter.Host || entry.User != filter.User {
+		return false
+	}
+
+	if filter.Database != "" && entry.Database != filter.Database {
+		return false
+	}
+
+	if !filter.Internal && entry.Origin == OriginInternal {
+		return false
+	}
+
+	if filter.Before > 0 && entry.ID >= filter.Before {
+		return false
+	}
+
+	if entry.Timestamp < filter.Since {
+		return false
+	}
+
+	return filter.Text == "" || strings.Contains(strings.ToLower(entry.Query), strings.ToLower(filter.Text))
+}
+
+// HistoryStore persists the query history in a JSON lines file, appending an
+// entry per query. The file is compacted once it grows past the retention
+// limits, keeping the entries younger than maxAge and, among them, the newest
+// maxEntries user entries. Internal entries have their own maxEntries budget,
+// so metadata queries never push the user's queries out of the history.
+// Entries past maxAge but not compacted yet are never returned.
+type HistoryStore struct {
+	mu         sync.Mutex
+	path       string
+	maxEntries int
+	maxAge     time.Duration
+
+	// Number of user and internal entries in the file, time of the oldest
+	// one and ID of the last one, loaded on first append
+	loaded   bool
+	entries  int
+	internal int
+	oldest   int64
+	lastID   int64
+}
+
+// NewHistoryStore creates a store writing to path. A zero maxAge keeps
+// entries forever.
+func NewHistoryStore(path string, maxEntries int, maxAge time.Duration) *HistoryStore {
+	return &HistoryStore{
+		path:       path,
+		maxEntries: maxEntries,
+		maxAge:     maxAge,
+	}
+}
+
+// getHistoryPath returns the path of the history file, creating its
+// directory when missing
+func getHistoryPath() string {
+	path, _ := homedir.Dir()
+	dir := filepath.Join(path, ".mysqlweb")
+
+	os.MkdirAll(dir, 0o700)
+
+	return filepath.Join(dir, "history.jsonl")
+}
+
+// Append adds the entry to the history, giving it an ID
+func (s *HistoryStore) Append(entry Query) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded {
+		if err := s.load(); err != nil {
+			return err
+		}
+	}
+
+	// IDs follow the time, but must be unique even when the clock is coarse
+	entry.ID = time.Now().UnixNano()
+	if entry.ID <= s.lastID {
+		entry.ID = s.lastID + 1
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+
+	// Don't glue the entry to the last line of an interrupted write
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			data = append([]byte{'\n'}, data...)
+		}
+	}
+
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	s.count(entry)
+	s.lastID = entry.ID
+
+	// Leave some room so the file is not rewritten on every query
+	if limit := s.maxEntries + s.maxEntries/10; s.entries > limit || s.internal > limit {
+		return s.compact()
+	}
+	if s.maxAge > 0 && s.oldest < time.Now().Add(-s.maxAge-s.maxAge/10).Unix() {
+		return s.compact()
+	}
+
+	return nil
+}
+
+// Search returns the entries selected by the filter, newest first
+func (s *HistoryStore) Search(filter HistoryFilter) ([]Query, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultHistoryLimit
+	}
+
+	// Entries past the age limit may still be in the file
+	filter.Since = max(filter.Since, s.cutoff())
+
+	var found []Query
+
+	err := s.read(func(entry Query) {
+		if !filter.matches(entry) {
+			return
+		}
+
+		found = append(found, entry)
+
+		// Only the newest ones are kept, which come last
+		if len(found) > 2*filter.Limit {
+			found = append(found[:0], found[len(found)-filter.Limit:]...)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(found) > filter.Limit {
+		found = found[len(found)-filter.Limit:]
+	}
+
+	entries := make([]Query, len(found))
+	for i, entry := range found {
+		entries[len(found)-1-i] = entry
+	}
+
+	return entries, nil
+}
+
+// Compact applies the retention limits to the file
+func (s *HistoryStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.compact()
+}
+
+// compact rewrites the file without the entries past the retention limits.
+// Must be called with mu held.
+func (s *HistoryStore) compact() error {
+	var entries []Query
+
+	cutoff := s.cutoff()
+
+	err := s.read(func(entry Query) {
+		if entry.Timestamp >= cutoff {
+			entries = append(entries, entry)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// Keep the newest entries of each origin
+	keep := make([]bool, len(entries))
+	users, internal := 0, 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Origin == OriginInternal {
+			internal++
+			keep[i] = internal <= s.maxEntries
+		} else {
+			users++
+			keep[i] = users <= s.maxEntries
+		}
+	}
+
+	var buf bytes.Buffer
+	oldest := int64(0)
+	for i, entry := range entries {
+		if !keep[i] {
+			continue
+		}
+
+		if oldest == 0 {
+			oldest = entry.Timestamp
+		}
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	if err := writeFileAtomic(s.path, buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+
+	s.entries, s.internal = min(users, s.maxEntries), min(internal, s.maxEntries)
+	s.oldest = oldest
+
+	return nil
+}
+
+// cutoff returns the Unix time before which entries are past the age limit
+func (s *HistoryStore) cutoff() int64 {
+	if s.maxAge <= 0 {
+		return 0
+	}
+
+	return time.Now().Add(-s.maxAge).Unix()
+}
+
+// count adds the entry to the number of entries of its origin, keeping track
+// of the oldest one
+func (s *HistoryStore) count(entry Query) {
+	if entry.Origin == OriginInternal {
+		s.internal++
+	} else {
+		s.entries++
+	}
+
+	if s.oldest == 0 || entry.Timestamp < s.oldest {
+		s.oldest = entry.Timestamp
+	}
+}
+
+// load counts the entries of the file. Must be called with mu held.
+func (s *HistoryStore) load() error {
+	s.entries, s.internal, s.oldest = 0, 0, 0
+
+	err := s.read(func(entry Query) {
+		s.count(entry)
+		if entry.ID > s.lastID {
+			s.lastID = entry.ID
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	s.loaded = true
+
+	return nil
+}
+
+// read calls fn for each entry of the file, oldest first. Lines that can't
+// be decoded, e.g. the last one of an interrupted write, are skipped.
+func (s *HistoryStore) read(fn func(Query)) error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+
+		if len(bytes.TrimSpace(line)) > 0 {
+			var entry Query
+			if json.Unmarshal(line, &entry) == nil {
+				fn(entry)
+			}
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("Reading the history failed: %s", err)
+		}
+	}
+}
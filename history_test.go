@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryStore(t *testing.T) {
+	store := NewHistoryStore(filepath.Join(t.TempDir(), "history.jsonl"), 100, 0)
+	now := time.Now().Unix()
+
+	queries := []Query{
+		{Timestamp: now, Host: "db1", User: "root", Database: "app", Query: "SELECT 1"},
+		{Timestamp: now, Host: "db1", User: "root", Database: "app", Query: "select * from users"},
+		{Timestamp: now, Host: "db2", User: "root", Database: "app", Query: "SELECT 2"},
+		{Timestamp: now, Host: "db1", User: "root", Database: "shop", Query: "SELECT 3"},
+	}
+	for _, query := range queries {
+		assert.NoError(t, store.Append(query))
+	}
+
+	entries, err := store.Search(HistoryFilter{Host: "db1", User: "root"})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "SELECT 3", entries[0].Query)
+	assert.True(t, entries[0].ID > entries[1].ID)
+
+	entries, err = store.Search(HistoryFilter{Host: "db1", User: "root", Text: "USERS"})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	entries, err = store.Search(HistoryFilter{Host: "db1", User: "root", Database: "app", Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "select * from users", entries[0].Query)
+
+	entries, err = store.Search(HistoryFilter{Host: "db1", User: "root", Before: entries[0].ID})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "SELECT 1", entries[0].Query)
+}
+
+func TestHistoryStore_Retention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	store := NewHistoryStore(path, 10, time.Hour)
+
+	// The entry past the age limit is dropped as soon as it is added
+	old := time.Now().Add(-2 * time.Hour).Unix()
+	assert.NoError(t, store.Append(Query{Timestamp: old, Query: "SELECT 0"}))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+
+	for i := 0; i < 12; i++ {
+		assert.NoError(t, store.Append(Query{Timestamp: time.Now().Unix(), Query: "SELECT 1"}))
+	}
+
+	// The limit is exceeded by more than 10% once the 12th entry is added
+	entries, err := store.Search(HistoryFilter{Limit: 100})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 10)
+	for _, entry := range entries {
+		assert.Equal(t, "SELECT 1", entry.Query)
+	}
+}
+
+func TestHistoryStore_SearchAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	old := time.Now().Add(-2 * time.Hour).Unix()
+	data := fmt.Sprintf("{\"id\":1,\"timestamp\":%d,\"query\":\"SELECT 0\"}\n{\"id\":2,\"timestamp\":%d,\"query\":\"SELECT 1\"}\n", old, time.Now().Unix())
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+
+	// Entries past the age limit are hidden until the file is compacted
+	store := NewHistoryStore(path, 100, time.Hour)
+	entries, err := store.Search(HistoryFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "SELECT 1", entries[0].Query)
+}
+
+func TestHistoryStore_RetentionInternal(t *testing.T) {
+	store := NewHistoryStore(filepath.Join(t.TempDir(), "history.jsonl"), 10, 0)
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, store.Append(Query{Query: "SELECT 1", Origin: OriginUser}))
+	}
+	for i := 0; i < 30; i++ {
+		assert.NoError(t, store.Append(Query{Query: "SHOW TABLES", Origin: OriginInternal}))
+	}
+
+	// Metadata queries don't push the user's queries out
+	entries, err := store.Search(HistoryFilter{Limit: 100})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 5)
+
+	entries, err = store.Search(HistoryFilter{Limit: 100, Internal: true})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 5+10)
+}
+
+func TestHistoryStore_CorruptLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	assert.NoError(t, os.WriteFile(path, []byte("{\"id\":5,\"query\":\"SELECT 1\"}\n{\"id\":6,\"que"), 0o600))
+
+	store := NewHistoryStore(path, 100, 0)
+	assert.NoError(t, store.Append(Query{Query: "SELECT 2"}))
+
+	entries, err := store.Search(HistoryFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestHistoryStore_Internal(t *testing.T) {
+	store := NewHistoryStore(filepath.Join(t.TempDir(), "history.jsonl"), 100, 0)
+
+	assert.NoError(t, store.Append(Query{Query: "SHOW DATABASES", Origin: OriginInternal}))
+	assert.NoError(t, store.Append(Query{Query: "SELECT 1", Origin: OriginUser}))
+
+	entries, err := store.Search(HistoryFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "SELECT 1", entries[0].Query)
+
+	entries, err = store.Search(HistoryFilter{Internal: true})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestRecordExecution(t *testing.T) {
+	previous := history
+	history = NewHistoryStore(filepath.Join(t.TempDir(), "history.jsonl"), 100, 0)
+	defer func() { history = previous }()
+
+	client := &Client{host: "localhost", user: "root", dbName: "app"}
+
+	client.recordExecution(Query{Query: "DELETE FROM t", Origin: OriginUser, RowsAffected: 3}, time.Now(), nil)
+	client.recordExecution(Query{Query: "SELEC", Database: "shop", Origin: OriginUser}, time.Now(), errors.New("syntax error"))
+
+	entries, err := client.History(HistoryFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	assert.Equal(t, "SELEC", entries[0].Query)
+	assert.Equal(t, "shop", entries[0].Database)
+	assert.Equal(t, HistoryError, entries[0].Status)
+	assert.Equal(t, "syntax error", entries[0].Error)
+
+	assert.Equal(t, "app", entries[1].Database)
+	assert.Equal(t, HistorySuccess, entries[1].Status)
+	assert.Equal(t, int64(3), entries[1].RowsAffected)
+	assert.Equal(t, "localhost", entries[1].Host)
+}
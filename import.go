@@ -0,0 +1,791 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Formats of imported files
+const (
+	ImportCSV    = "csv"
+	ImportNDJSON = "ndjson"
+)
+
+const (
+	defaultImportBatchSize = 500
+
+	// maxImportErrors is the number of row errors after which reading the
+	// file stops
+	maxImportErrors = 100
+
+	// maxPlaceholders is the number of ? placeholders a statement can hold
+	maxPlaceholders = 65535
+)
+
+// ImportOptions controls how an uploaded file is loaded into a table
+type ImportOptions struct {
+	Format string
+	// CSV holds the delimiter, NULL marker and header settings of CSV files,
+	// quoting always follows RFC 4180
+	CSV CSVOptions
+	// NullSet reports whether the NULL marker was given. When it wasn't,
+	// empty CSV fields are NULL in columns other than text ones.
+	NullSet bool
+	// Mapping renames the columns of the file to table columns, mapping a
+	// column to an empty name skips it
+	Mapping   map[string]string
+	BatchSize int
+	// DryRun only validates the rows, nothing is inserted
+	DryRun bool
+
+	// positional maps the CSV fields to the table columns by position, the
+	// header being skipped
+	positional bool
+}
+
+// ImportError is a problem found in a row of the uploaded file
+type ImportError struct {
+	Line    int    `json:"line"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportSummary reports the outcome of an import. Rows are only committed
+// when no error was found.
+type ImportSummary struct {
+	Rows            int           `json:"rows"`
+	Inserted        int64         `json:"inserted"`
+	Batches         int           `json:"batches"`
+	DryRun          bool          `json:"dry_run"`
+	Committed       bool          `json:"committed"`
+	Errors          []ImportError `json:"errors"`
+	ErrorsTruncated bool          `json:"errors_truncated,omitempty"`
+	Duration        int64         `json:"duration"`
+	// CreateStatement is the statement that created the table, if any
+	CreateStatement string `json:"create_statement,omitempty"`
+}
+
+// importRow is a row of the uploaded file, keyed by file column name. Values
+// are either nil for NULL or strings.
+type importRow struct {
+	line   int
+	values map[string]interface{}
+	err    error
+}
+
+// rowReader reads the rows of an uploaded file. A row that can't be parsed
+// is returned with its err set, io.EOF is returned at the end of the file.
+type rowReader interface {
+	Next() (*importRow, error)
+}
+
+// csvRowReader reads CSV files, the first record being the header unless
+// disabled, in which case fields map to the table columns by position
+type csvRowReader struct {
+	reader  *csv.Reader
+	header  []string
+	opts    CSVOptions
+	nullSet bool
+}
+
+func newCSVRowReader(r io.Reader, opts ImportOptions, columns []TableColumn) (*csvRowReader, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = opts.CSV.Delimiter
+	reader.FieldsPerRecord = -1
+
+	cr := &csvRowReader{reader: reader, opts: opts.CSV, nullSet: opts.NullSet}
+
+	if opts.CSV.Header {
+		header, err := reader.Read()
+		if err == io.EOF {
+			return nil, errors.New("File is empty")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(header) > 0 {
+			header[0] = strings.TrimPrefix(header[0], "\ufeff")
+		}
+		cr.header = header
+
+		if !opts.positional {
+			return cr, nil
+		}
+
+		if len(header) != len(columns) {
+			return nil, fmt.Errorf("File has %d columns, the table %d", len(header), len(columns))
+		}
+	}
+
+	cr.header = make([]string, len(columns))
+	for i, column := range columns {
+		cr.header[i] = column.Name
+	}
+
+	return cr, nil
+}
+
+func (cr *csvRowReader) Next() (*importRow, error) {
+	record, err := cr.reader.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &importRow{line: parseErr.Line, err: parseErr.Err}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	line, _ := cr.reader.FieldPos(0)
+	row := &importRow{line: line}
+
+	if len(record) != len(cr.header) {
+		row.err = fmt.Errorf("Expected %d fields, got %d", len(cr.header), len(record))
+		return row, nil
+	}
+
+	row.values = make(map[string]interface{}, len(record))
+	for i, field := range record {
+		if cr.nullSet && field == cr.opts.Null {
+			row.values[cr.header[i]] = nil
+		} else {
+			row.values[cr.header[i]] = field
+		}
+	}
+
+	return row, nil
+}
+
+// ndjsonRowReader reads one JSON object per line
+type ndjsonRowReader struct {
+	reader *bufio.Reader
+	line   int
+}
+
+func newNDJSONRowReader(r io.Reader) *ndjsonRowReader {
+	return &ndjsonRowReader{reader: bufio.NewReader(r)}
+}
+
+func (nr *ndjsonRowReader) Next() (*importRow, error) {
+	for {
+		data, err := nr.reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		nr.line++
+		data = bytes.TrimSpace(data)
+
+		if len(data) == 0 {
+			if err == io.EOF {
+				return nil, err
+			}
+			continue
+		}
+
+		return nr.parse(data), nil
+	}
+}
+
+func (nr *ndjsonRowReader) parse(data []byte) *importRow {
+	row := &importRow{line: nr.line}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil || object == nil {
+		row.err = errors.New("Line is not a JSON object")
+		return row
+	}
+
+	row.values = make(map[string]interface{}, len(object))
+	for key, value := range object {
+		switch v := value.(type) {
+		case nil, string:
+			row.values[key] = v
+		case json.Number:
+			row.values[key] = v.String()
+		case bool:
+			row.values[key] = "0"
+			if v {
+				row.values[key] = "1"
+			}
+		default:
+			// Objects and arrays, for JSON columns
+			encoded, _ := json.Marshal(v)
+			row.values[key] = string(encoded)
+		}
+	}
+
+	return row
+}
+
+// textDataTypes are the column types where an empty string is a value
+var textDataTypes = map[string]bool{
+	"char":       true,
+	"varchar":    true,
+	"tinytext":   true,
+	"text":       true,
+	"mediumtext": true,
+	"longtext":   true,
+	"enum":       true,
+	"set":        true,
+	"binary":     true,
+	"varbinary":  true,
+	"tinyblob":   true,
+	"blob":       true,
+	"mediumblob": true,
+	"longblob":   true,
+}
+
+// numberPattern matches the plain decimal numbers, with an optional
+// exponent, accepted by the numeric columns. NaN, infinities and hexadecimal
+// floats are left out.
+var numberPattern = regexp.MustCompile(`^[-+]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][-+]?[0-9]+)?$`)
+
+// importValue checks that a value of the uploaded file fits the column and
+// returns the value to bind
+func importValue(column TableColumn, value interface{}) (interface{}, error) {
+	if value == nil {
+		if !column.Nullable {
+			return nil, errors.New("Column doesn't accept NULL")
+		}
+		return nil, nil
+	}
+
+	text := value.(string)
+
+	switch strings.ToLower(column.DataType) {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "year", "bit":
+		// Bound as numbers, BIT columns would take strings as raw bytes
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n, nil
+		}
+		if n, err := strconv.ParseUint(text, 10, 64); err == nil {
+			return n, nil
+		}
+		return nil, fmt.Errorf("%q is not an integer", text)
+	case "decimal", "numeric", "float", "double", "real":
+		if !numberPattern.MatchString(text) {
+			return nil, fmt.Errorf("%q is not a number", text)
+		}
+	case "date":
+		if _, err := time.Parse("2006-01-02", text); err != nil && !strings.HasPrefix(text, "0000-00-00") {
+			return nil, fmt.Errorf("%q is not a date (YYYY-MM-DD)", text)
+		}
+	case "datetime", "timestamp":
+		text = strings.Replace(text, "T", " ", 1)
+		if !validDatetime(text) {
+			return nil, fmt.Errorf("%q is not a date and time (YYYY-MM-DD hh:mm:ss)", text)
+		}
+	case "json":
+		if !json.Valid([]byte(text)) {
+			return nil, errors.New("Value is not valid JSON")
+		}
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		data, err := decodeBinary(text)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid binary value: %s", err)
+		}
+		if column.MaxLength != nil && int64(len(data)) > *column.MaxLength {
+			return nil, fmt.Errorf("Value is longer than %d bytes", *column.MaxLength)
+		}
+		return data, nil
+	}
+
+	if textDataTypes[strings.ToLower(column.DataType)] && column.MaxLength != nil {
+		if int64(utf8.RuneCountInString(text)) > *column.MaxLength {
+			return nil, fmt.Errorf("Value is longer than %d characters", *column.MaxLength)
+		}
+	}
+
+	return text, nil
+}
+
+// validDatetime reports whether text is a DATETIME literal, dates alone and
+// zero dates being accepted as MySQL does
+func validDatetime(text string) bool {
+	if strings.HasPrefix(text, "0000-00-00") {
+		return true
+	}
+
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999", "2006-01-02"} {
+		if _, err := time.Parse(layout, text); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// insertStatement builds a multi-row INSERT of the rows, whose values are
+// keyed by table column. Columns missing from a row get their DEFAULT.
+func insertStatement(table string, columns []TableColumn, rows []map[string]interface{}) (string, []interface{}) {
+	var names []string
+	for _, column := range columns {
+		for _, row := range rows {
+			if _, ok := row[column.Name]; ok {
+				names = append(names, column.Name)
+				break
+			}
+		}
+	}
+
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdentifier(name)
+	}
+
+	var args []interface{}
+	tuples := make([]string, len(rows))
+
+	for i, row := range rows {
+		values := make([]string, len(names))
+
+		for j, name := range names {
+			value, ok := row[name]
+			if !ok {
+				values[j] = "DEFAULT"
+				continue
+			}
+
+			values[j] = "?"
+			args = append(args, value)
+		}
+
+		tuples[i] = "(" + strings.Join(values, ", ") + ")"
+	}
+
+	query := fmt.Sprintf(MySQLInsertRows, table, strings.Join(quoted, ", "), strings.Join(tuples, ", "))
+
+	return query, args
+}
+
+// importer maps the rows of a file to the table columns and inserts them
+// in batches
+type importer struct {
+	opts    ImportOptions
+	columns []TableColumn
+	byName  map[string]TableColumn
+	summary *ImportSummary
+}
+
+// target returns the table column a column of the file is loaded into, nil
+// if it is skipped
+func (imp *importer) target(name string) (*TableColumn, error) {
+	if mapped, ok := imp.opts.Mapping[name]; ok {
+		if mapped == "" {
+			return nil, nil
+		}
+		name = mapped
+	}
+
+	column, ok := imp.byName[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("Unknown column %s", name)
+	}
+
+	return &column, nil
+}
+
+// convert validates a row of the file and keys its values by table column.
+// Problems are added to the summary.
+func (imp *importer) convert(row *importRow) (map[string]interface{}, bool) {
+	if row.err != nil {
+		imp.addError(ImportError{Line: row.line, Message: row.err.Error()})
+		return nil, false
+	}
+
+	values := make(map[string]interface{}, len(row.values))
+	valid := true
+
+	for name, value := range row.values {
+		column, err := imp.target(name)
+		if err != nil {
+			imp.addError(ImportError{Line: row.line, Column: name, Message: err.Error()})
+			valid = false
+			continue
+		}
+		if column == nil {
+			continue
+		}
+
+		if imp.opts.Format == ImportCSV && !imp.opts.NullSet && value == "" && !textDataTypes[strings.ToLower(column.DataType)] {
+			value = nil
+		}
+
+		converted, err := importValue(*column, value)
+		if err != nil {
+			imp.addError(ImportError{Line: row.line, Column: column.Name, Message: err.Error()})
+			valid = false
+			continue
+		}
+
+		values[column.Name] = converted
+	}
+
+	return values, valid
+}
+
+func (imp *importer) addError(err ImportError) {
+	if len(imp.summary.Errors) >= maxImportErrors {
+		imp.summary.ErrorsTruncated = true
+		return
+	}
+
+	imp.summary.Errors = append(imp.summary.Errors, err)
+}
+
+// Import loads the rows of a CSV or NDJSON file into the table. Rows are
+// validated against the column types and inserted in batches within a
+// single transaction, committed only if every row was inserted. The
+// transaction runs on its own connection, apart from the session.
+//
+// Errors about the file as a whole, like an unknown column in the CSV
+// header, are returned as is. Errors about rows are reported in the summary.
+func (client *Client) Import(ctx context.Context, database string, table string, source io.Reader, opts ImportOptions) (*ImportSummary, error) {
+	columns, err := client.TableColumnList(database, table)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.importRows(ctx, database, table, columns, source, opts)
+}
+
+// importRows loads the rows into the table made of the given columns
+func (client *Client) importRows(ctx context.Context, database string, table string, columns []TableColumn, source io.Reader, opts ImportOptions) (*ImportSummary, error) {
+	var err error
+	start := time.Now()
+
+	imp := &importer{
+		opts:    opts,
+		columns: columns,
+		byName:  make(map[string]TableColumn, len(columns)),
+		summary: &ImportSummary{DryRun: opts.DryRun, Errors: []ImportError{}},
+	}
+	for _, column := range columns {
+		imp.byName[strings.ToLower(column.Name)] = column
+	}
+
+	var reader rowReader
+
+	switch opts.Format {
+	case ImportNDJSON:
+		reader = newNDJSONRowReader(source)
+	default:
+		csvReader, err := newCSVRowReader(source, opts, columns)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range csvReader.header {
+			if _, err := imp.target(name); err != nil {
+				return nil, err
+			}
+		}
+		reader = csvReader
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultImportBatchSize
+	}
+	if batchSize*len(columns) > maxPlaceholders {
+		batchSize = maxPlaceholders / len(columns)
+	}
+
+	var tx *sqlx.Tx
+	if !opts.DryRun {
+		tx, err = client.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+	}
+
+	var batch []map[string]interface{}
+	batchLine := 0
+	failed := false
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if opts.DryRun {
+			batch = batch[:0]
+			return nil
+		}
+
+		query, args := insertStatement(qualifiedName(database, table), columns, batch)
+		batch = batch[:0]
+
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		inserted, _ := res.RowsAffected()
+		imp.summary.Inserted += inserted
+		imp.summary.Batches++
+
+		return nil
+	}
+
+	for !imp.summary.ErrorsTruncated {
+		row, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		imp.summary.Rows++
+
+		values, valid := imp.convert(row)
+		if !valid {
+			failed = true
+		}
+
+		// Once a row is invalid, the rest of the file is only validated
+		if failed {
+			continue
+		}
+
+		if len(batch) == 0 {
+			batchLine = row.line
+		}
+		batch = append(batch, values)
+
+		if len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				imp.addError(ImportError{Line: batchLine, Message: fmt.Sprintf("Batch starting at line %d failed: %s", batchLine, err)})
+				failed = true
+			}
+		}
+	}
+
+	if !failed {
+		if err := flush(); err != nil {
+			imp.addError(ImportError{Line: batchLine, Message: fmt.Sprintf("Batch starting at line %d failed: %s", batchLine, err)})
+			failed = true
+		}
+	}
+
+	if !failed && !opts.DryRun {
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		imp.summary.Committed = true
+	}
+
+	if !imp.summary.Committed {
+		imp.summary.Inserted = 0
+	}
+
+	imp.summary.Duration = time.Since(start).Milliseconds()
+
+	if !opts.DryRun {
+		entry := Query{
+			Query:        fmt.Sprintf("-- Import into %s", qualifiedName(database, table)),
+			Database:     database,
+			Origin:       OriginUser,
+			RowsAffected: imp.summary.Inserted,
+		}
+
+		var importErr error
+		if len(imp.summary.Errors) > 0 {
+			first := imp.summary.Errors[0]
+			importErr = fmt.Errorf("Line %d: %s", first.Line, first.Message)
+		}
+
+		client.recordExecution(entry, start, importErr)
+	}
+
+	return imp.summary, nil
+}
+
+// parseImportOptions reads the format, delimiter, null, header, mapping,
+// batch_size and dry_run parameters. The format defaults to the one
+// matching the extension of the file name.
+func parseImportOptions(params url.Values, filename string) (ImportOptions, error) {
+	opts := ImportOptions{Format: params.Get("format")}
+	defaults := DefaultCSVOptions()
+
+	extension := strings.ToLower(filepath.Ext(filename))
+
+	if opts.Format == "" {
+		switch extension {
+		case ".ndjson", ".jsonl", ".json":
+			opts.Format = ImportNDJSON
+		default:
+			opts.Format = ImportCSV
+		}
+	}
+
+	switch opts.Format {
+	case ImportCSV, ImportNDJSON:
+	case "tsv":
+		opts.Format = ImportCSV
+		defaults.Delimiter = '\t'
+	default:
+		return opts, fmt.Errorf("Unknown import format %q, expected csv, tsv or ndjson", opts.Format)
+	}
+
+	if extension == ".tsv" {
+		defaults.Delimiter = '\t'
+	}
+
+	csvOptions, err := parseCSVOptions(params, defaults)
+	if err != nil {
+		return opts, err
+	}
+	opts.CSV = csvOptions
+	_, opts.NullSet = params["null"]
+
+	if mapping := params.Get("mapping"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &opts.Mapping); err != nil {
+			return opts, errors.New("Mapping must be a JSON object of file column to table column")
+		}
+	}
+
+	if batchSize := params.Get("batch_size"); batchSize != "" {
+		opts.BatchSize, err = strconv.Atoi(batchSize)
+		if err != nil || opts.BatchSize <= 0 {
+			return opts, fmt.Errorf("Invalid batch size %q", batchSize)
+		}
+	}
+
+	if dryRun := params.Get("dry_run"); dryRun != "" {
+		opts.DryRun, err = strconv.ParseBool(dryRun)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid dry_run value %q", dryRun)
+		}
+	}
+
+	return opts, nil
+}
+
+// maxFormValueSize is the size limit of the form values sent along with an
+// uploaded file
+const maxFormValueSize = 1 << 20
+
+// uploadedFile returns the file sent in the file field of a multipart form,
+// or the raw request body, along with the request parameters and the file
+// name, if any. The form is read as a stream, the file being handed over
+// without being buffered, so the form values must precede it; the ones
+// following it are ignored.
+func uploadedFile(c *gin.Context) (io.ReadCloser, url.Values, string, error) {
+	params := c.Request.URL.Query()
+
+	if !strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		return c.Request.Body, params, "", nil
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, nil, "", errors.New("File is missing")
+		}
+		if err != nil {
+			return nil, nil, "", err
+		}
+
+		if part.FormName() == "file" {
+			// Closing the part would read the rest of the upload
+			return io.NopCloser(part), params, part.FileName(), nil
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, maxFormValueSize+1))
+		if err != nil {
+			return nil, nil, "", err
+		}
+		if len(value) > maxFormValueSize {
+			return nil, nil, "", fmt.Errorf("Form value %s is too large", part.FormName())
+		}
+
+		params.Add(part.FormName(), string(value))
+	}
+}
+
+// APIImportTable loads an uploaded CSV or NDJSON file into the table. The
+// file is sent in the file field of a multipart form or as the raw request
+// body. With create=true the table is created first from the columns
+// sniffed from the CSV file, or the ones given in the columns parameter.
+// The summary is returned with 422 when rows failed and nothing was
+// imported.
+func APIImportTable(c *gin.Context) {
+	dbClient := getClient(c)
+
+	source, params, filename, err := uploadedFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+	defer source.Close()
+
+	opts, err := parseImportOptions(params, filename)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	database := c.Params.ByName("database")
+	table := c.Params.ByName("table")
+
+	var summary *ImportSummary
+
+	if create, _ := strconv.ParseBool(params.Get("create")); create {
+		var columns []TableColumn
+		if value := params.Get("columns"); value != "" {
+			if err := json.Unmarshal([]byte(value), &columns); err != nil {
+				c.JSON(http.StatusBadRequest, Error{"Columns must be a JSON array of columns"})
+				return
+			}
+		}
+
+		summary, err = dbClient.CreateTableFromFile(c.Request.Context(), database, table, source, columns, opts)
+	} else {
+		summary, err = dbClient.Import(c.Request.Context(), database, table, source, opts)
+	}
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	status := http.StatusOK
+	if len(summary.Errors) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+
+	c.JSON(status, summary)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var importColumns = []TableColumn{
+	{Name: "id", DataType: "int"},
+	{Name: "name", DataType: "varchar", Nullable: true, MaxLength: int64Ptr(5)},
+	{Name: "created", DataType: "datetime", Nullable: true},
+}
+
+func readAll(t *testing.T, reader rowReader) []*importRow {
+	var rows []*importRow
+
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			return rows
+		}
+		assert.NoError(t, err)
+		rows = append(rows, row)
+	}
+}
+
+func TestCSVRowReader(t *testing.T) {
+	opts := DefaultCSVOptions()
+	opts.Null = `\N`
+
+	reader, err := newCSVRowReader(strings.NewReader("\ufeffid,name\n1,\"a,b\"\n2,\\N\n3\n"), ImportOptions{CSV: opts, NullSet: true}, importColumns)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", "name"}, reader.header)
+
+	rows := readAll(t, reader)
+	assert.Len(t, rows, 3)
+	assert.Equal(t, map[string]interface{}{"id": "1", "name": "a,b"}, rows[0].values)
+	assert.Equal(t, map[string]interface{}{"id": "2", "name": nil}, rows[1].values)
+	assert.Equal(t, 4, rows[2].line)
+	assert.Error(t, rows[2].err)
+}
+
+func TestCSVRowReader_NoHeader(t *testing.T) {
+	opts := DefaultCSVOptions()
+	opts.Header = false
+
+	reader, err := newCSVRowReader(strings.NewReader("1,a,2024-01-01 10:00:00\n"), ImportOptions{CSV: opts}, importColumns)
+	assert.NoError(t, err)
+
+	rows := readAll(t, reader)
+	assert.Equal(t, map[string]interface{}{"id": "1", "name": "a", "created": "2024-01-01 10:00:00"}, rows[0].values)
+}
+
+func TestNDJSONRowReader(t *testing.T) {
+	reader := newNDJSONRowReader(strings.NewReader("{\"id\":1,\"name\":null,\"ok\":true,\"tags\":[1]}\n\n[1]\n{\"id\":12345678901234567890}"))
+
+	rows := readAll(t, reader)
+	assert.Len(t, rows, 3)
+	assert.Equal(t, map[string]interface{}{"id": "1", "name": nil, "ok": "1", "tags": "[1]"}, rows[0].values)
+	assert.Equal(t, 3, rows[1].line)
+	assert.Error(t, rows[1].err)
+	assert.Equal(t, "12345678901234567890", rows[2].values["id"])
+}
+
+func TestImportValue(t *testing.T) {
+	value, err := importValue(importColumns[0], "42")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), value)
+
+	value, err = importValue(importColumns[2], "2024-01-01T10:00:00")
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-01-01 10:00:00", value)
+
+	for _, number := range []string{"-1.5", "+.5", "10.", "1.2e-3"} {
+		value, err = importValue(TableColumn{Name: "price", DataType: "decimal"}, number)
+		assert.NoError(t, err)
+		assert.Equal(t, number, value)
+	}
+
+	value, err = importValue(TableColumn{Name: "data", DataType: "blob"}, "0xCAFE")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xca, 0xfe}, value)
+
+	invalid := []struct {
+		column TableColumn
+		value  interface{}
+	}{
+		{importColumns[0], nil},
+		{importColumns[0], "4.2"},
+		{importColumns[1], "toolong"},
+		{importColumns[2], "yesterday"},
+		{TableColumn{Name: "doc", DataType: "json"}, "{"},
+		{TableColumn{Name: "price", DataType: "decimal"}, "ten"},
+		{TableColumn{Name: "price", DataType: "decimal"}, "NaN"},
+		{TableColumn{Name: "price", DataType: "decimal"}, "-Inf"},
+		{TableColumn{Name: "price", DataType: "decimal"}, "0x1p-2"},
+		{TableColumn{Name: "price", DataType: "decimal"}, "1_000"},
+		{TableColumn{Name: "data", DataType: "varbinary", MaxLength: int64Ptr(1)}, "0xCAFE"},
+	}
+
+	for _, test := range invalid {
+		_, err := importValue(test.column, test.value)
+		assert.Error(t, err, test.value)
+	}
+}
+
+func TestInsertStatement(t *testing.T) {
+	query, args := insertStatement("`db`.`users`", importColumns, []map[string]interface{}{
+		{"id": int64(1), "name": "a"},
+		{"id": int64(2)},
+	})
+
+	assert.Equal(t, "INSERT INTO `db`.`users` (`id`, `name`) VALUES (?, ?), (?, DEFAULT)", query)
+	assert.Equal(t, []interface{}{int64(1), "a", int64(2)}, args)
+}
+
+func TestImporterConvert(t *testing.T) {
+	imp := &importer{
+		opts:    ImportOptions{Format: ImportCSV, Mapping: map[string]string{"full_name": "name", "skip": ""}},
+		byName:  map[string]TableColumn{"id": importColumns[0], "name": importColumns[1], "created": importColumns[2]},
+		summary: &ImportSummary{},
+	}
+
+	values, valid := imp.convert(&importRow{line: 2, values: map[string]interface{}{"ID": "1", "full_name": "", "skip": "x", "created": ""}})
+	assert.True(t, valid)
+	assert.Equal(t, map[string]interface{}{"id": int64(1), "name": "", "created": nil}, values)
+
+	_, valid = imp.convert(&importRow{line: 3, values: map[string]interface{}{"id": "x", "other": "1"}})
+	assert.False(t, valid)
+	assert.Len(t, imp.summary.Errors, 2)
+}
+
+func TestParseImportOptions(t *testing.T) {
+	opts, err := parseImportOptions(url.Values{"dry_run": {"true"}, "null": {`\N`}, "mapping": {`{"a":"b"}`}}, "data.tsv")
+	assert.NoError(t, err)
+	assert.Equal(t, ImportCSV, opts.Format)
+	assert.Equal(t, '\t', opts.CSV.Delimiter)
+	assert.True(t, opts.NullSet)
+	assert.True(t, opts.DryRun)
+	assert.Equal(t, map[string]string{"a": "b"}, opts.Mapping)
+
+	opts, err = parseImportOptions(url.Values{}, "data.jsonl")
+	assert.NoError(t, err)
+	assert.Equal(t, ImportNDJSON, opts.Format)
+
+	invalid := []url.Values{
+		{"format": {"xml"}},
+		{"mapping": {"[1]"}},
+		{"batch_size": {"0"}},
+		{"dry_run": {"maybe"}},
+	}
+
+	for _, params := range invalid {
+		_, err := parseImportOptions(params, "")
+		assert.Error(t, err, params.Encode())
+	}
+}
+
+func TestUploadedFile(t *testing.T) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("format", "csv")
+	file, _ := form.CreateFormFile("file", "data.csv")
+	file.Write([]byte("id\n1\n"))
+	form.WriteField("ignored", "true")
+	form.Close()
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/import?dry_run=true", &body)
+	c.Request.Header.Set("Content-Type", form.FormDataContentType())
+
+	source, params, filename, err := uploadedFile(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "data.csv", filename)
+	assert.Equal(t, url.Values{"dry_run": {"true"}, "format": {"csv"}}, params)
+
+	data, err := io.ReadAll(source)
+	assert.NoError(t, err)
+	assert.Equal(t, "id\n1\n", string(data))
+
+	body.Reset()
+	form = multipart.NewWriter(&body)
+	form.WriteField("format", "csv")
+	form.Close()
+
+	c.Request = httptest.NewRequest(http.MethodPost, "/import", &body)
+	c.Request.Header.Set("Content-Type", form.FormDataContentType())
+
+	_, _, _, err = uploadedFile(c)
+	assert.EqualError(t, err, "File is missing")
+}
@@ -7,6 +7,7 @@ import (
 	"os/signal"
 	"os/user"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/go-sql-driver/mysql"
@@ -31,13 +32,25 @@ var options struct {
 	AuthUser string `long:"auth-user" description:"HTTP basic auth user"`
 	AuthPass string `long:"auth-pass" description:"HTTP basic auth password"`
 	SkipOpen bool   `short:"s" long:"skip-open" description:"Skip browser open on start"`
+
+	IdleTimeout  time.Duration `long:"idle-timeout" description:"Close connections idle for longer than this duration (0 to disable)" default:"30m"`
+	MaxSessions  int           `long:"max-sessions" description:"Maximum number of open connections (0 for no limit)" default:"20"`
+	MaxRows      int           `long:"max-rows" description:"Maximum number of rows returned by a query (0 for no limit)" default:"100000"`
+	QueryTimeout time.Duration `long:"query-timeout" description:"Kill queries running for longer than this duration (0 to disable)" default:"0"`
+	SafeUpdates  string        `long:"safe-updates" description:"Policy for UPDATE & DELETE without WHERE: off, warn or block" default:"block"`
+	ReadOnly     bool          `long:"readonly" description:"Only allow statements reading data on every connection"`
+
+	BinaryEncoding string `long:"binary-encoding" description:"Encoding of binary values in results: hex or base64" default:"hex"`
+	BlobPreview    int    `long:"blob-preview" description:"Number of bytes of binary values shown in the grid (0 for no limit)" default:"64"`
+
+	HistorySize int           `long:"history-size" description:"Maximum number of queries kept in the history, internal ones counted apart (0 to disable it)" default:"10000"`
+	HistoryAge  time.Duration `long:"history-age" description:"Drop history entries older than this duration (0 to keep them)" default:"2160h"`
+
+	BookmarkKey string `long:"bookmark-key" description:"Master key encrypting the bookmark passwords (defaults to a generated ~/.mysqlweb/bookmark.key)"`
 }
 
-// var dbClient *Client
-var (
-	dbClientMap map[string]*Client
-	dbConnArr   []Connection
-)
+// registry holds all the open client connections
+var registry *Registry
 
 func exitWithMessage(message string) {
 	fmt.Println("Error:", message)
@@ -107,16 +120,17 @@ func initClient() {
 		return
 	}
 	url := getConnectionString()
-	clientKey, err := NewClientFromURL(url)
+	client, err := NewClientFromURL(url)
 	if err != nil {
 		exitWithMessage(err.Error())
 	}
 
-	fmt.Println("Connecting to server...")
-	client := dbClientMap[clientKey]
+	client.readOnly = options.ReadOnly
 
+	fmt.Println("Connecting to server...")
 	err = client.Test()
 	if err != nil {
+		client.Close()
 		exitWithMessage(err.Error())
 	}
 
@@ -126,10 +140,13 @@ func initClient() {
 		Port:     port,
 		Username: user,
 		Database: database,
-		ConnID:   clientKey,
+		ReadOnly: client.readOnly,
 	}
 
-	dbConnArr = append(dbConnArr, dbConn)
+	if _, err := registry.Add(client, dbConn); err != nil {
+		client.Close()
+		exitWithMessage(err.Error())
+	}
 }
 
 func initOptions() {
@@ -143,6 +160,18 @@ func initOptions() {
 		options.Url = os.Getenv("DATABASE_URL")
 	}
 
+	if options.BookmarkKey == "" {
+		options.BookmarkKey = os.Getenv("MYSQLWEB_BOOKMARK_KEY")
+	}
+
+	if err := validateSafeUpdatePolicy(options.SafeUpdates); err != nil {
+		exitWithMessage(err.Error())
+	}
+
+	if err := validateBinaryEncoding(options.BinaryEncoding); err != nil {
+		exitWithMessage(err.Error())
+	}
+
 	if options.Version {
 		fmt.Printf("pgweb v%s\n", VERSION)
 		os.Exit(0)
@@ -160,45 +189,89 @@ func startServer() {
 
 	router.GET("/", APIHome)
 	router.POST("/connect", APIConnect)
-	router.DELETE("/disconnect", APIClose)
-	router.GET("/databases", APIGetDatabases)
-	router.GET("/databases/:database/tables", APIGetDatabaseTables)
-	router.GET("/databases/:database/tables/:table/column", APIGetColumnOfTable)
-	router.GET("/databases/:database/views", APIGetDatabaseViews)
-	router.GET("/databases/:database/procedures", APIGetDatabaseProcedures)
-	router.GET("/databases/:database/functions", APIGetDatabaseFunctions)
-	router.POST("/databases/:database/actions/default", APISetDefaultDatabase)
 	router.GET("/info", APIInfo)
-	router.GET("/tables/:table/info", APIGetTableInfo)
-	router.GET("/tables/:table/indexes", APITableIndexes)
-	router.GET("/query", APIRunQueryGet)
-	router.POST("/query", APIRunQuery)
-	router.GET("/explain", APIExplainQuery)
-	router.POST("/explain", APIExplainQuery)
-	router.GET("/history", APIHistory)
 	router.GET("/static/*filepath", APIServeAsset)
-	router.GET("/procedures/:procedure/parameters", APIProcedureParameters)
-	router.GET("/collation", APIGetCollationCharSet)
-	router.POST("/databases/:database/actions/alter", APIAlterDatabase)
-	router.DELETE("/databases/:database/actions/drop", APIDropDatabase)
-	router.DELETE("/databases/:database/tables/:table/actions/drop", APIDropTable)
-	router.DELETE("/databases/:database/tables/:table/actions/truncate", APITruncateTable)
-	router.GET("/databases/:database/procedures/:procedure", APIProcedureDefinition)
-	router.GET("/databases/:database/functions/:function", APIFunctionDefinition)
-	router.POST("/databases/:database/procedures/:procedure", APICreateProcedure)
-	router.POST("/databases/:database/functions/:function", APICreateFunction)
-	router.DELETE("/databases/:database/procedures/:procedure/actions/drop", APIDropProcedure)
-	router.GET("/databases/:database/views/:view", APIViewDefinition)
-	router.GET("/search/:query", apiSearch)
 	router.GET("/bookmarks", APIGetBookmarks)
 	router.POST("/bookmarks/:name", APISaveBookmark)
+	router.PUT("/bookmarks/:name", APIUpdateBookmark)
+	router.POST("/bookmarks/:name/rename", APIRenameBookmark)
+	router.POST("/bookmarks/:name/connect", APIConnectBookmark)
 	router.DELETE("/bookmarks/:name", APIDeleteBookmark)
+	router.GET("/snippets", APIGetSnippets)
+	router.GET("/snippets/export", APIExportSnippets)
+	router.POST("/snippets/import", APIImportSnippets)
+	router.GET("/snippets/:name", APIGetSnippet)
+	router.POST("/snippets/:name", APICreateSnippet)
+	router.PUT("/snippets/:name", APIUpdateSnippet)
+	router.DELETE("/snippets/:name", APIDeleteSnippet)
 	router.GET("/updates", getUpdate)
 
+	// Routes below operate on an open connection
+	conn := router.Group("/", RequireClient())
+
+	conn.DELETE("/disconnect", APIClose)
+	conn.GET("/databases", APIGetDatabases)
+	conn.GET("/databases/:database/tables", APIGetDatabaseTables)
+	conn.GET("/databases/:database/tables/:table/column", APIGetColumnOfTable)
+	conn.GET("/databases/:database/tables/:table/rows", APIGetTableRows)
+	conn.POST("/databases/:database/tables/:table/rows", DenyReadOnly(), APIInsertRow)
+	conn.PATCH("/databases/:database/tables/:table/rows", DenyReadOnly(), APIUpdateRow)
+	conn.DELETE("/databases/:database/tables/:table/rows", DenyReadOnly(), APIDeleteRows)
+	conn.GET("/databases/:database/tables/:table/blob", APIGetBlob)
+	conn.POST("/databases/:database/tables/:table/import", DenyReadOnly(), APIImportTable)
+	conn.POST("/databases/:database/tables/:table/sniff", APISniffTable)
+	conn.GET("/databases/:database/views", APIGetDatabaseViews)
+	conn.GET("/databases/:database/dump", APIDumpDatabase)
+	conn.POST("/databases/:database/restore", DenyReadOnly(), APIRestoreDatabase)
+	conn.GET("/databases/:database/procedures", APIGetDatabaseProcedures)
+	conn.GET("/databases/:database/functions", APIGetDatabaseFunctions)
+	conn.POST("/databases/:database/actions/default", APISetDefaultDatabase)
+	conn.GET("/tables/:table/info", APIGetTableInfo)
+	conn.GET("/tables/:table/indexes", APITableIndexes)
+	conn.GET("/query", APIRunQueryGet)
+	conn.POST("/query", APIRunQuery)
+	conn.POST("/query/:id/cancel", APICancelQuery)
+	conn.POST("/script", APIRunScript)
+	conn.POST("/transaction/begin", APIBeginTransaction)
+	conn.POST("/transaction/commit", APICommitTransaction)
+	conn.POST("/transaction/rollback", APIRollbackTransaction)
+	conn.GET("/settings", APIGetSettings)
+	conn.POST("/settings", APISaveSettings)
+	conn.GET("/explain", APIExplainQuery)
+	conn.POST("/explain", APIExplainQuery)
+	conn.GET("/history", APIHistory)
+	conn.GET("/procedures/:procedure/parameters", APIProcedureParameters)
+	conn.GET("/collation", APIGetCollationCharSet)
+	conn.POST("/databases/:database/actions/alter", DenyReadOnly(), APIAlterDatabase)
+	conn.DELETE("/databases/:database/actions/drop", DenyReadOnly(), APIDropDatabase)
+	conn.DELETE("/databases/:database/tables/:table/actions/drop", DenyReadOnly(), APIDropTable)
+	conn.DELETE("/databases/:database/tables/:table/actions/truncate", DenyReadOnly(), APITruncateTable)
+	conn.GET("/databases/:database/procedures/:procedure", APIProcedureDefinition)
+	conn.GET("/databases/:database/functions/:function", APIFunctionDefinition)
+	conn.POST("/databases/:database/procedures/:procedure", DenyReadOnly(), APICreateProcedure)
+	conn.POST("/databases/:database/functions/:function", DenyReadOnly(), APICreateFunction)
+	conn.DELETE("/databases/:database/procedures/:procedure/actions/drop", DenyReadOnly(), APIDropProcedure)
+	conn.GET("/databases/:database/views/:view", APIViewDefinition)
+	conn.GET("/search/:query", apiSearch)
+	conn.POST("/snippets/:name/run", APIRunSnippet)
+
 	fmt.Println("Starting server...")
 	go router.Run(fmt.Sprintf("%v:%v", options.HttpHost, options.HttpPort))
 }
 
+func initHistory() {
+	if options.HistorySize <= 0 {
+		return
+	}
+
+	history = NewHistoryStore(getHistoryPath(), options.HistorySize, options.HistoryAge)
+
+	// Apply the retention limits to the entries of the previous runs
+	if err := history.Compact(); err != nil {
+		fmt.Println("Error:", err)
+	}
+}
+
 func handleSignals() {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, os.Kill)
@@ -226,8 +299,10 @@ func main() {
 
 	fmt.Println("mysqlweb version", VERSION)
 
-	dbClientMap = make(map[string]*Client)
+	registry = NewRegistry(options.IdleTimeout, options.MaxSessions)
+	go registry.StartReaper(time.Minute, nil)
 
+	initHistory()
 	initClient()
 
 	if !options.Debug {
@@ -241,4 +316,6 @@ func main() {
 	startServer()
 	openPage()
 	handleSignals()
+
+	registry.CloseAll()
 }
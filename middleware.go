@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Keys under which the resolved connection is stored in the gin context
+const (
+	clientContextKey = "client"
+	connIDContextKey = "conn_id"
+)
+
+// connectionID reads the connection id from the X-CONN-ID header, falling
+// back to the conn_id parameter used by plain links (e.g. CSV downloads).
+// Only the URL is looked at, the body must be left for raw uploads.
+func connectionID(c *gin.Context) string {
+	id := c.Request.Header.Get("X-CONN-ID")
+
+	// If id missing from header, check in query string
+	if id == "" {
+		id = c.Query("conn_id")
+	}
+
+	return id
+}
+
+// RequireClient resolves the client of the request connection once and
+// stores it in the context. Requests without a connection id are rejected
+// with 401, unknown or expired connections with 404.
+func RequireClient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := connectionID(c)
+
+		if id == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, Error{"Connection id is missing"})
+			return
+		}
+
+		// The session must not expire while a long request, e.g. a dump,
+		// is running
+		client := registry.Acquire(id)
+		if client == nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, Error{"Connection not found"})
+			return
+		}
+		defer registry.Release(id)
+
+		c.Set(clientContextKey, client)
+		c.Set(connIDContextKey, id)
+
+		c.Next()
+	}
+}
+
+// getClient returns the client resolved by RequireClient
+func getClient(c *gin.Context) *Client {
+	return c.MustGet(clientContextKey).(*Client)
+}
+
+// getConnID returns the connection id resolved by RequireClient
+func getConnID(c *gin.Context) string {
+	return c.GetString(connIDContextKey)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/test", RequireClient(), func(c *gin.Context) {
+		c.String(http.StatusOK, getConnID(c))
+	})
+
+	return router
+}
+
+func TestRequireClient(t *testing.T) {
+	registry = NewRegistry(0, 0)
+	id, _ := registry.Add(newTestClient(t), Connection{})
+	router := newTestRouter()
+
+	tests := []struct {
+		name   string
+		url    string
+		header string
+		status int
+	}{
+		{"missing id", "/test", "", http.StatusUnauthorized},
+		{"unknown id", "/test", "stale", http.StatusNotFound},
+		{"header", "/test", id, http.StatusOK},
+		{"query fallback", "/test?conn_id=" + id, "", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.url, nil)
+		if test.header != "" {
+			req.Header.Set("X-CONN-ID", test.header)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, test.status, w.Code, test.name)
+	}
+}
+
+func TestRequireClient_KeepsBody(t *testing.T) {
+	registry = NewRegistry(0, 0)
+	id, _ := registry.Add(newTestClient(t), Connection{})
+
+	router := newTestRouter()
+	router.POST("/upload", RequireClient(), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/upload?conn_id="+id, strings.NewReader("a=1;b=2"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "a=1;b=2", w.Body.String())
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MySQLSessionReadOnly makes every transaction of the session read only
+const MySQLSessionReadOnly = "SET SESSION TRANSACTION READ ONLY"
+
+// ErrReadOnly is returned when a statement would modify data or schema on a
+// read only connection
+var ErrReadOnly = errors.New("Connection is read only, only statements reading data are allowed")
+
+// readOnlyKinds are the statement kinds allowed on read only connections
+var readOnlyKinds = map[string]bool{
+	KindRead:        true,
+	KindTransaction: true,
+	KindSession:     true,
+}
+
+// ReadOnly reports whether the client only accepts statements reading data
+func (client *Client) ReadOnly() bool {
+	return client.readOnly
+}
+
+// checkReadOnly rejects the statements not allowed on a read only client
+func (client *Client) checkReadOnly(query string) error {
+	if !client.readOnly {
+		return nil
+	}
+
+	if !readOnlyKinds[classifyStatement(query).Kind] || switchesToReadWrite(query) || writesOutsideData(query) {
+		return ErrReadOnly
+	}
+
+	return nil
+}
+
+// switchesToReadWrite reports whether the statement lifts the read only
+// restriction of the session, e.g. SET SESSION TRANSACTION READ WRITE
+func switchesToReadWrite(query string) bool {
+	tokens := tokenize(query)
+
+	if len(tokens) == 0 || !(tokens[0].is("SET") || tokens[0].is("START")) {
+		return false
+	}
+
+	for i, token := range tokens {
+		if token.is("READ") && i+1 < len(tokens) && tokens[i+1].is("WRITE") {
+			return true
+		}
+
+		if token.Kind == tokenWord || token.Kind == tokenVariable {
+			name := strings.ToLower(token.Value)
+			if strings.Contains(name, "transaction_read_only") || strings.Contains(name, "tx_read_only") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// writesOutsideData reports whether a statement otherwise allowed on read
+// only connections changes the server or its files: SET PASSWORD, SET GLOBAL
+// or PERSIST and SELECT ... INTO OUTFILE or DUMPFILE
+func writesOutsideData(query string) bool {
+	tokens := tokenize(query)
+
+	for i, token := range tokens {
+		if token.is("INTO") && i+1 < len(tokens) && (tokens[i+1].is("OUTFILE") || tokens[i+1].is("DUMPFILE")) {
+			return true
+		}
+	}
+
+	if len(tokens) < 2 || !tokens[0].is("SET") {
+		return false
+	}
+
+	if tokens[1].is("PASSWORD") {
+		return true
+	}
+
+	// Scopes come first in each assignment of the list
+	for i, token := range tokens {
+		if i > 0 && !tokens[i-1].is("SET") && !tokens[i-1].is(",") {
+			continue
+		}
+
+		if token.is("GLOBAL") || token.is("PERSIST") || token.is("PERSIST_ONLY") {
+			return true
+		}
+
+		if token.Kind == tokenVariable {
+			name := strings.ToLower(token.Value)
+			if strings.HasPrefix(name, "@@global.") || strings.HasPrefix(name, "@@persist.") || strings.HasPrefix(name, "@@persist_only.") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// DenyReadOnly rejects the request with 403 when the connection is read
+// only. It must run after RequireClient.
+func DenyReadOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if getClient(c).ReadOnly() {
+			c.AbortWithStatusJSON(http.StatusForbidden, NewError(ErrReadOnly))
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckReadOnly(t *testing.T) {
+	client := newTestClient(t)
+	client.readOnly = true
+
+	allowed := []string{
+		"SELECT * FROM t",
+		"SHOW TABLES",
+		"EXPLAIN DELETE FROM t WHERE id = 1",
+		"USE shop",
+		"SET @x = 1",
+		"START TRANSACTION READ ONLY",
+		"SELECT @@transaction_read_only",
+		"SET @x = 1, @@session.sql_mode = ''",
+		"SELECT outfile FROM t",
+	}
+
+	for _, query := range allowed {
+		assert.NoError(t, client.checkReadOnly(query), query)
+	}
+
+	denied := []string{
+		"UPDATE t SET a = 1 WHERE id = 1",
+		"INSERT INTO t VALUES (1)",
+		"DROP TABLE t",
+		"/* hi */ truncate t",
+		"WITH x AS (SELECT 1) DELETE FROM t WHERE id = 1",
+		"CALL cleanup()",
+		"SET SESSION TRANSACTION READ WRITE",
+		"SET SESSION transaction_read_only = 0",
+		"SET @@session.tx_read_only = OFF",
+		"START TRANSACTION READ WRITE",
+		"SET PASSWORD = 'secret'",
+		"set password for 'app'@'%' = 'secret'",
+		"SET GLOBAL max_connections = 1",
+		"SET @x = 1, PERSIST max_connections = 1",
+		"SET PERSIST_ONLY max_connections = 1",
+		"SET @@global.sql_mode = ''",
+		"SET @@persist.max_connections = 1",
+		"SELECT * FROM t INTO OUTFILE '/tmp/t.csv'",
+		"SELECT a INTO DUMPFILE '/tmp/a' FROM t",
+		"/* x */ WITH c AS (SELECT 1) SELECT * FROM c INTO OUTFILE '/tmp/c'",
+	}
+
+	for _, query := range denied {
+		assert.Equal(t, ErrReadOnly, client.checkReadOnly(query), query)
+	}
+
+	client.readOnly = false
+	assert.NoError(t, client.checkReadOnly("DROP TABLE t"))
+}
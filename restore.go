@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// restoreProgressInterval is the minimum delay between two progress
+	// reports
+	restoreProgressInterval = time.Second
+
+	// maxReportedQuery is the length the failing statement is cut to, as
+	// dumps hold large INSERT statements
+	maxReportedQuery = 1000
+)
+
+// Types of the restore progress reports
+const (
+	RestoreRunning = "progress"
+	RestoreDone    = "done"
+	RestoreFailed  = "error"
+)
+
+// RestoreProgress reports how far a restore went. The last report tells
+// whether it succeeded, the failing statement being given otherwise.
+type RestoreProgress struct {
+	Type       string `json:"type"`
+	Statements int    `json:"statements"`
+	Line       int    `json:"line"`
+	// BytesRead counts the bytes of the uploaded file, compressed or not
+	BytesRead int64           `json:"bytes_read"`
+	Duration  int64           `json:"duration_ms"`
+	Query     string          `json:"query,omitempty"`
+	Error     *StatementError `json:"error,omitempty"`
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r     io.Reader
+	count int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.count += int64(n)
+	return n, err
+}
+
+// decompressed returns a reader decompressing source when it starts with the
+// gzip magic number, or reading it as is otherwise
+func decompressed(source io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(source)
+
+	magic, err := buffered.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(buffered)
+	}
+
+	return buffered, nil
+}
+
+// truncateQuery cuts long statements for reporting
+func truncateQuery(query string) string {
+	if len(query) <= maxReportedQuery {
+		return query
+	}
+
+	// Don't cut a multibyte character
+	end := maxReportedQuery
+	for end > 0 && !utf8.RuneStart(query[end]) {
+		end--
+	}
+
+	return query[:end] + "…"
+}
+
+// Restore executes the statements of a SQL script, gzipped or not, one after
+// the other on a dedicated connection using the database. The script is
+// read as it is executed, so it is never held in memory. It stops at the
+// first failing statement, which is reported in the returned progress.
+// report is called at most once per restoreProgressInterval while the
+// statements run. Errors not related to a statement, such as a connection
+// or a read error, are returned.
+func (client *Client) Restore(ctx context.Context, database string, source io.Reader, report func(RestoreProgress)) (*RestoreProgress, error) {
+	counter := &countingReader{r: source}
+
+	script, err := decompressed(counter)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := client.db.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// The script changes session variables such as FOREIGN_KEY_CHECKS and
+	// may stop before restoring them, the connection is not reused
+	defer conn.Raw(func(driverConn interface{}) error {
+		return driver.ErrBadConn
+	})
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(MySQLUseDatabase, quoteIdentifier(database))); err != nil {
+		return nil, err
+	}
+
+	entry := Query{Query: fmt.Sprintf("-- Restore of %s", quoteIdentifier(database)), Database: database, Origin: OriginUser}
+
+	start := time.Now()
+	lastReport := start
+	progress := &RestoreProgress{Type: RestoreRunning}
+	scanner := NewStatementScanner(script)
+
+	for {
+		stmt, err := scanner.Next()
+		if err == io.EOF {
+			break
+		}
+
+		progress.Line = scanner.Line()
+		progress.BytesRead = counter.count
+		progress.Duration = time.Since(start).Milliseconds()
+
+		if err != nil {
+			err = fmt.Errorf("Reading the script failed at line %d: %s", scanner.Line(), err)
+			client.recordExecution(entry, start, err)
+			return progress, err
+		}
+
+		// Dumps legitimately empty tables, the safe update policy is meant
+		// for statements typed by hand and doesn't apply
+		if _, err = execContext(ctx, conn, stmt.SQL); err != nil {
+			progress.Type = RestoreFailed
+			progress.Query = truncateQuery(stmt.SQL)
+			progress.Error = newStatementError(stmt, err)
+			progress.Duration = time.Since(start).Milliseconds()
+
+			client.recordExecution(entry, start, fmt.Errorf("Line %d: %s", progress.Error.Line, progress.Error.Message))
+			return progress, nil
+		}
+
+		progress.Statements++
+
+		if time.Since(lastReport) >= restoreProgressInterval {
+			lastReport = time.Now()
+			progress.Duration = time.Since(start).Milliseconds()
+			report(*progress)
+		}
+	}
+
+	progress.Type = RestoreDone
+	progress.Line = scanner.Line()
+	progress.BytesRead = counter.count
+	progress.Duration = time.Since(start).Milliseconds()
+
+	client.recordExecution(entry, start, nil)
+
+	return progress, nil
+}
+
+// APIRestoreDatabase executes an uploaded SQL script, gzipped or not, in the
+// database. The file is sent in the file field of a multipart form or as the
+// raw request body. Progress is streamed as NDJSON, one report per line, the
+// last one telling whether the restore succeeded.
+func APIRestoreDatabase(c *gin.Context) {
+	dbClient := getClient(c)
+
+	source, _, _, err := uploadedFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+	defer source.Close()
+
+	started := false
+	encoder := json.NewEncoder(c.Writer)
+
+	send := func(progress RestoreProgress) {
+		if !started {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Status(http.StatusOK)
+			started = true
+		}
+
+		encoder.Encode(progress)
+		c.Writer.Flush()
+	}
+
+	progress, err := dbClient.Restore(c.Request.Context(), c.Params.ByName("database"), source, send)
+	if err != nil {
+		// Nothing is streamed yet, the error can have its own status
+		if !started {
+			c.JSON(http.StatusBadRequest, NewError(err))
+			return
+		}
+
+		progress.Type = RestoreFailed
+		progress.Error = &StatementError{Message: err.Error(), Line: progress.Line}
+	}
+
+	send(*progress)
+}
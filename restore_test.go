@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecompressed(t *testing.T) {
+	script := "CREATE TABLE t (id INT);\nINSERT INTO t VALUES (1);\n"
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(script))
+	gz.Close()
+
+	for _, source := range []io.Reader{strings.NewReader(script), &compressed} {
+		r, err := decompressed(source)
+		assert.NoError(t, err)
+
+		data, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, script, string(data))
+	}
+}
+
+func TestDecompressed_Short(t *testing.T) {
+	for _, script := range []string{"", ";"} {
+		r, err := decompressed(strings.NewReader(script))
+		assert.NoError(t, err)
+
+		data, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, script, string(data))
+	}
+}
+
+func TestCountingReader(t *testing.T) {
+	counter := &countingReader{r: strings.NewReader("SELECT 1;")}
+
+	io.ReadAll(counter)
+	assert.Equal(t, int64(9), counter.count)
+}
+
+func TestTruncateQuery(t *testing.T) {
+	assert.Equal(t, "SELECT 1", truncateQuery("SELECT 1"))
+
+	query := strings.Repeat("a", maxReportedQuery-1) + "é" + "b"
+	assert.Equal(t, strings.Repeat("a", maxReportedQuery-1)+"…", truncateQuery(query))
+}
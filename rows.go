@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultRowsLimit = 100
+
+// filterOperators maps the operators of row filters to their SQL, ? being
+// the value placeholder
+var filterOperators = map[string]string{
+	"=":           "= ?",
+	"!=":          "<> ?",
+	"<":           "< ?",
+	"<=":          "<= ?",
+	">":           "> ?",
+	">=":          ">= ?",
+	"like":        "LIKE ?",
+	"not like":    "NOT LIKE ?",
+	"in":          "IN",
+	"not in":      "NOT IN",
+	"is null":     "IS NULL",
+	"is not null": "IS NOT NULL",
+}
+
+// RowFilter restricts the browsed rows to the ones whose column compares to
+// the value. Value is a list for the in operators and is not used by the
+// null ones.
+type RowFilter struct {
+	Column string      `json:"column"`
+	Op     string      `json:"op"`
+	Value  interface{} `json:"value"`
+}
+
+// SortColumn is a column of the ORDER BY clause
+type SortColumn struct {
+	Column string
+	Desc   bool
+}
+
+// RowsQuery describes a page of table rows. Pages are addressed either by
+// Offset or by Cursor, the primary key of the last row of the previous page.
+type RowsQuery struct {
+	Limit   int
+	Offset  int
+	Cursor  string
+	Sort    []SortColumn
+	Filters []RowFilter
+}
+
+// TableRows is a page of table rows
+type TableRows struct {
+	*Result
+	PrimaryKey []string `json:"primary_key"`
+	Limit      int      `json:"limit"`
+	Offset     int      `json:"offset"`
+	HasMore    bool     `json:"has_more"`
+	// NextCursor is set when the rows are sorted by primary key and more
+	// rows follow
+	NextCursor string `json:"next_cursor,omitempty"`
+	// EstimatedRows is the row count of the whole table estimated by the
+	// server, filters are not taken into account
+	EstimatedRows *int64 `json:"estimated_rows"`
+}
+
+// rowsSelect is a compiled RowsQuery
+type rowsSelect struct {
+	query string
+	args  []interface{}
+	// keyset tells whether the rows are sorted by primary key, so a cursor
+	// can be returned
+	keyset bool
+}
+
+// encodeCursor turns the primary key of a row into a cursor
+func encodeCursor(values []string) string {
+	data, _ := json.Marshal(values)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor reads the primary key values of a cursor
+func decodeCursor(cursor string) ([]string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.New("Invalid cursor")
+	}
+
+	var values []string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, errors.New("Invalid cursor")
+	}
+
+	return values, nil
+}
+
+// filterArg converts a filter value to the argument bound for the column
+func filterArg(value interface{}, column TableColumn) (interface{}, error) {
+	var text string
+
+	switch v := value.(type) {
+	case string:
+		text = v
+	case json.Number:
+		text = v.String()
+	case bool:
+		text = "0"
+		if v {
+			text = "1"
+		}
+	case nil:
+		return nil, fmt.Errorf("Missing value for column %s", column.Name)
+	default:
+		return nil, fmt.Errorf("Invalid value for column %s", column.Name)
+	}
+
+	return columnArg(text, column)
+}
+
+// columnArg converts a text value to the argument bound for the column,
+// binary values being given in the configured encoding
+func columnArg(text string, column TableColumn) (interface{}, error) {
+	if !binaryTypes[baseType(column.DataType)] {
+		return text, nil
+	}
+
+	data, err := decodeBinary(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid binary value for column %s", column.Name)
+	}
+
+	return data, nil
+}
+
+// condition compiles the filter into a condition with placeholders for the
+// values
+func (filter RowFilter) condition(columns map[string]TableColumn) (string, []interface{}, error) {
+	column, ok := columns[filter.Column]
+	if !ok {
+		return "", nil, fmt.Errorf("Unknown column %s", filter.Column)
+	}
+
+	op := strings.ToLower(strings.Join(strings.Fields(filter.Op), " "))
+	operator, ok := filterOperators[op]
+	if !ok {
+		return "", nil, fmt.Errorf("Invalid operator %q", filter.Op)
+	}
+
+	name := quoteIdentifier(column.Name)
+
+	switch op {
+	case "is null", "is not null":
+		return name + " " + operator, nil, nil
+	case "in", "not in":
+		values, ok := filter.Value.([]interface{})
+		if !ok || len(values) == 0 {
+			return "", nil, fmt.Errorf("Operator %s expects a non empty list of values", op)
+		}
+
+		args := make([]interface{}, len(values))
+		for i, value := range values {
+			arg, err := filterArg(value, column)
+			if err != nil {
+				return "", nil, err
+			}
+			args[i] = arg
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+		return fmt.Sprintf("%s %s (%s)", name, operator, placeholders), args, nil
+	}
+
+	arg, err := filterArg(filter.Value, column)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return name + " " + operator, []interface{}{arg}, nil
+}
+
+// sortsByKey reports whether the sort is empty or made of the primary key
+// columns, in order and in the same direction
+func sortsByKey(sort []SortColumn, primaryKey []string) bool {
+	if len(sort) == 0 {
+		return true
+	}
+
+	if len(sort) != len(primaryKey) {
+		return false
+	}
+
+	for i, column := range sort {
+		if column.Column != primaryKey[i] || column.Desc != sort[0].Desc {
+			return false
+		}
+	}
+
+	return true
+}
+
+// compileRowsQuery builds the SELECT statement reading a page of rows. Rows
+// are sorted by primary key unless told otherwise, so pages are stable. One
+// row more than the limit is read to know whether more follow.
+func compileRowsQuery(database string, table string, columns []TableColumn, primaryKey []string, q RowsQuery) (*rowsSelect, error) {
+	byName := make(map[string]TableColumn, len(columns))
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		byName[column.Name] = column
+		names[i] = quoteIdentifier(column.Name)
+	}
+
+	sel := &rowsSelect{
+		keyset: len(primaryKey) > 0 && sortsByKey(q.Sort, primaryKey),
+	}
+
+	var conditions []string
+
+	for _, filter := range q.Filters {
+		condition, args, err := filter.condition(byName)
+		if err != nil {
+			return nil, err
+		}
+
+		conditions = append(conditions, condition)
+		sel.args = append(sel.args, args...)
+	}
+
+	desc := len(q.Sort) > 0 && q.Sort[0].Desc
+
+	if q.Cursor != "" {
+		if !sel.keyset {
+			return nil, errors.New("A cursor can only be used when sorting by primary key")
+		}
+
+		values, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != len(primaryKey) {
+			return nil, errors.New("Invalid cursor")
+		}
+
+		keys := make([]string, len(primaryKey))
+		for i, name := range primaryKey {
+			keys[i] = quoteIdentifier(name)
+
+			arg, err := columnArg(values[i], byName[name])
+			if err != nil {
+				return nil, err
+			}
+			sel.args = append(sel.args, arg)
+		}
+
+		comparison := ">"
+		if desc {
+			comparison = "<"
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ")
+		conditions = append(conditions, fmt.Sprintf("(%s) %s (%s)", strings.Join(keys, ", "), comparison, placeholders))
+	}
+
+	sort := q.Sort
+	if len(sort) == 0 {
+		for _, name := range primaryKey {
+			sort = append(sort, SortColumn{Column: name})
+		}
+	}
+
+	var order []string
+	for _, column := range sort {
+		if _, ok := byName[column.Column]; !ok {
+			return nil, fmt.Errorf("Unknown column %s", column.Column)
+		}
+
+		clause := quoteIdentifier(column.Column)
+		if column.Desc {
+			clause += " DESC"
+		}
+		order = append(order, clause)
+	}
+
+	var query bytes.Buffer
+
+	fmt.Fprintf(&query, "SELECT %s FROM %s", strings.Join(names, ", "), qualifiedName(database, table))
+	if len(conditions) > 0 {
+		fmt.Fprintf(&query, " WHERE %s", strings.Join(conditions, " AND "))
+	}
+	if len(order) > 0 {
+		fmt.Fprintf(&query, " ORDER BY %s", strings.Join(order, ", "))
+	}
+	fmt.Fprintf(&query, " LIMIT %d", q.Limit+1)
+	if q.Offset > 0 {
+		fmt.Fprintf(&query, " OFFSET %d", q.Offset)
+	}
+
+	sel.query = query.String()
+
+	return sel, nil
+}
+
+// TableRowEstimate returns the row count of the table estimated by the
+// server, as reported by TableInfo. It is nil when unknown, e.g. for views.
+func (client *Client) TableRowEstimate(database string, table string) (*int64, error) {
+	res, err := client.Query(MySQLTableRowEstimate, database, table)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.Rows) == 0 || res.Rows[0][0] == nil {
+		return nil, nil
+	}
+
+	estimate, err := strconv.ParseInt(textValue(res.Rows[0][0]), 10, 64)
+	if err != nil {
+		return nil, nil
+	}
+
+	return &estimate, nil
+}
+
+// TableRows returns a page of the rows of the table. While a transaction is
+// open the rows are read on the session, so they include the uncommitted
+// changes edits are checked against.
+func (client *Client) TableRows(ctx context.Context, database string, table string, q RowsQuery) (*TableRows, error) {
+	columns, err := client.TableColumnList(database, table)
+	if err != nil {
+		return nil, err
+	}
+
+	primaryKey, err := client.TablePrimaryKey(database, table)
+	if err != nil {
+		return nil, err
+	}
+
+	sel, err := compileRowsQuery(database, table, columns, primaryKey, q)
+	if err != nil {
+		return nil, err
+	}
+
+	var res *Result
+	if client.InTransaction() {
+		res, err = client.SessionQuery(ctx, sel.query, sel.args...)
+	} else {
+		res, err = client.Query(sel.query, sel.args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	page := &TableRows{
+		Result:     res,
+		PrimaryKey: primaryKey,
+		Limit:      q.Limit,
+		Offset:     q.Offset,
+	}
+
+	if len(res.Rows) > q.Limit {
+		res.Rows = res.Rows[:q.Limit]
+		page.HasMore = true
+	}
+
+	if page.HasMore && sel.keyset {
+		last := res.Rows[len(res.Rows)-1]
+
+		values := make([]string, len(primaryKey))
+		for i, name := range primaryKey {
+			for j, column := range columns {
+				if column.Name == name {
+					values[i] = textValue(last[j])
+				}
+			}
+		}
+
+		page.NextCursor = encodeCursor(values)
+	}
+
+	page.EstimatedRows, err = client.TableRowEstimate(database, table)
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// parseSort reads columns separated by commas, a leading - sorting in
+// descending order
+func parseSort(value string) []SortColumn {
+	var sort []SortColumn
+
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		column := SortColumn{Column: name}
+		if strings.HasPrefix(name, "-") {
+			column = SortColumn{Column: name[1:], Desc: true}
+		}
+
+		sort = append(sort, column)
+	}
+
+	return sort
+}
+
+// parseRowsQuery reads the limit, offset, cursor, sort and filters
+// parameters, filters being a JSON array of {column, op, value} objects
+func parseRowsQuery(params url.Values) (RowsQuery, error) {
+	q := RowsQuery{
+		Limit:  defaultRowsLimit,
+		Cursor: params.Get("cursor"),
+		Sort:   parseSort(params.Get("sort")),
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		var err error
+		q.Limit, err = strconv.Atoi(limit)
+		if err != nil || q.Limit <= 0 {
+			return q, fmt.Errorf("Invalid limit %q", limit)
+		}
+	}
+
+	if options.MaxRows > 0 && q.Limit > options.MaxRows {
+		q.Limit = options.MaxRows
+	}
+
+	if offset := params.Get("offset"); offset != "" {
+		var err error
+		q.Offset, err = strconv.Atoi(offset)
+		if err != nil || q.Offset < 0 {
+			return q, fmt.Errorf("Invalid offset %q", offset)
+		}
+	}
+
+	if q.Cursor != "" && q.Offset > 0 {
+		return q, errors.New("offset and cursor can't be both set")
+	}
+
+	if filters := params.Get("filters"); filters != "" {
+		decoder := json.NewDecoder(strings.NewReader(filters))
+		decoder.UseNumber()
+
+		if err := decoder.Decode(&q.Filters); err != nil {
+			return q, errors.New("Filters must be a JSON array of {column, op, value} objects")
+		}
+	}
+
+	return q, nil
+}
+
+// APIGetTableRows returns a page of the rows of a table, see parseRowsQuery
+// for the parameters
+func APIGetTableRows(c *gin.Context) {
+	dbClient := getClient(c)
+
+	q, err := parseRowsQuery(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	page, err := dbClient.TableRows(c.Request.Context(), c.Params.ByName("database"), c.Params.ByName("table"), q)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
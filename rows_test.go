@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var rowsTestColumns = []TableColumn{
+	{Name: "id", DataType: "int"},
+	{Name: "name", DataType: "varchar"},
+	{Name: "hash", DataType: "varbinary"},
+}
+
+func TestCompileRowsQuery(t *testing.T) {
+	q, err := parseRowsQuery(url.Values{
+		"limit":   {"10"},
+		"offset":  {"20"},
+		"sort":    {"-name,id"},
+		"filters": {`[{"column":"name","op":"LIKE","value":"a%"},{"column":"id","op":"in","value":[1,2]},{"column":"hash","op":"is not null"}]`},
+	})
+	assert.NoError(t, err)
+
+	sel, err := compileRowsQuery("app", "users", rowsTestColumns, []string{"id"}, q)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT `id`, `name`, `hash` FROM `app`.`users` WHERE `name` LIKE ? AND `id` IN (?, ?) AND `hash` IS NOT NULL ORDER BY `name` DESC, `id` LIMIT 11 OFFSET 20", sel.query)
+	assert.Equal(t, []interface{}{"a%", "1", "2"}, sel.args)
+	assert.False(t, sel.keyset)
+}
+
+func TestCompileRowsQuery_Cursor(t *testing.T) {
+	q := RowsQuery{Limit: 5, Cursor: encodeCursor([]string{"42", "0xCAFE"})}
+
+	sel, err := compileRowsQuery("app", "tags", rowsTestColumns, []string{"id", "hash"}, q)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT `id`, `name`, `hash` FROM `app`.`tags` WHERE (`id`, `hash`) > (?, ?) ORDER BY `id`, `hash` LIMIT 6", sel.query)
+	assert.Equal(t, []interface{}{"42", []byte{0xca, 0xfe}}, sel.args)
+	assert.True(t, sel.keyset)
+
+	q.Sort = []SortColumn{{Column: "id", Desc: true}, {Column: "hash", Desc: true}}
+	sel, err = compileRowsQuery("app", "tags", rowsTestColumns, []string{"id", "hash"}, q)
+
+	assert.NoError(t, err)
+	assert.Contains(t, sel.query, "WHERE (`id`, `hash`) < (?, ?) ORDER BY `id` DESC, `hash` DESC")
+}
+
+func TestCompileRowsQuery_Invalid(t *testing.T) {
+	invalid := []RowsQuery{
+		{Limit: 1, Sort: []SortColumn{{Column: "missing"}}},
+		{Limit: 1, Filters: []RowFilter{{Column: "missing", Op: "=", Value: "1"}}},
+		{Limit: 1, Filters: []RowFilter{{Column: "id", Op: "; DROP", Value: "1"}}},
+		{Limit: 1, Filters: []RowFilter{{Column: "id", Op: "=", Value: nil}}},
+		{Limit: 1, Filters: []RowFilter{{Column: "id", Op: "in", Value: []interface{}{}}}},
+		{Limit: 1, Sort: []SortColumn{{Column: "name"}}, Cursor: encodeCursor([]string{"1"})},
+		{Limit: 1, Cursor: "not a cursor"},
+	}
+
+	for _, q := range invalid {
+		_, err := compileRowsQuery("app", "users", rowsTestColumns, []string{"id"}, q)
+		assert.Error(t, err, q)
+	}
+}
+
+func TestParseRowsQuery_Invalid(t *testing.T) {
+	invalid := []url.Values{
+		{"limit": {"0"}},
+		{"offset": {"-1"}},
+		{"offset": {"10"}, "cursor": {"abc"}},
+		{"filters": {"{}"}},
+	}
+
+	for _, params := range invalid {
+		_, err := parseRowsQuery(params)
+		assert.Error(t, err, params)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	values, err := decodeCursor(encodeCursor([]string{"1", "a,b"}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "a,b"}, values)
+}
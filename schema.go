@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TableColumn describes a column of a table as found in information_schema,
+// DataType being a DATA_TYPE value such as int, varchar or datetime
+type TableColumn struct {
+	Name      string `json:"name"`
+	DataType  string `json:"data_type"`
+	Nullable  bool   `json:"nullable"`
+	MaxLength *int64 `json:"max_length,omitempty"`
+	// Precision and Scale of decimals, Precision being the fractional
+	// seconds of datetimes
+	Precision *int64  `json:"precision,omitempty"`
+	Scale     *int64  `json:"scale,omitempty"`
+	Default   *string `json:"default,omitempty"`
+}
+
+// TableColumnList returns the columns of the table, in table order
+func (client *Client) TableColumnList(database string, table string) ([]TableColumn, error) {
+	res, err := client.TableColumns(database, table)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.Rows) == 0 {
+		return nil, fmt.Errorf("Table %s.%s doesn't exist", database, table)
+	}
+
+	columns := make([]TableColumn, len(res.Rows))
+
+	for i, row := range res.Rows {
+		columns[i] = tableColumn(row)
+	}
+
+	return columns, nil
+}
+
+// tableColumn reads a row of MySQLTableColumns
+func tableColumn(row Row) TableColumn {
+	column := TableColumn{
+		Name:     textValue(row[0]),
+		DataType: textValue(row[1]),
+		Nullable: textValue(row[2]) == "YES",
+	}
+
+	number := func(value interface{}) *int64 {
+		if value == nil {
+			return nil
+		}
+		if n, err := strconv.ParseInt(textValue(value), 10, 64); err == nil {
+			return &n
+		}
+		return nil
+	}
+
+	column.MaxLength = number(row[3])
+
+	if row[5] != nil {
+		value := textValue(row[5])
+		column.Default = &value
+	}
+
+	switch strings.ToLower(column.DataType) {
+	case "decimal", "numeric":
+		column.Precision = number(row[6])
+		column.Scale = number(row[7])
+	case "datetime", "timestamp", "time":
+		column.Precision = number(row[8])
+	}
+
+	return column
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableColumn(t *testing.T) {
+	zero := "0.00"
+	price := tableColumn(Row{"price", "decimal", "NO", nil, nil, "0.00", uint64(10), uint64(2), nil})
+	assert.Equal(t, TableColumn{Name: "price", DataType: "decimal", Precision: int64Ptr(10), Scale: int64Ptr(2), Default: &zero}, price)
+
+	created := tableColumn(Row{"created", "datetime", "YES", nil, nil, nil, nil, nil, uint64(3)})
+	assert.Equal(t, TableColumn{Name: "created", DataType: "datetime", Nullable: true, Precision: int64Ptr(3)}, created)
+
+	// Integers have a numeric precision too, which is not their definition
+	id := tableColumn(Row{"id", "int", "NO", nil, nil, nil, uint64(10), uint64(0), nil})
+	assert.Nil(t, id.Precision)
+	assert.Nil(t, id.Scale)
+
+	name := tableColumn(Row{"name", "varchar", "YES", int64(64), "utf8mb4", nil, nil, nil, nil})
+	assert.Equal(t, int64Ptr(64), name.MaxLength)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// errorLineRegex extracts the line reported by MySQL syntax errors, which is
+// relative to the statement
+var errorLineRegex = regexp.MustCompile(`at line (\d+)`)
+
+// rowStatements are the statements returning a resultset
+var rowStatements = map[string]bool{
+	"SELECT":   true,
+	"SHOW":     true,
+	"DESCRIBE": true,
+	"DESC":     true,
+	"EXPLAIN":  true,
+	"VALUES":   true,
+	"TABLE":    true,
+	"CALL":     true,
+	"HELP":     true,
+	"CHECK":    true,
+	"CHECKSUM": true,
+	"ANALYZE":  true,
+	"OPTIMIZE": true,
+	"REPAIR":   true,
+}
+
+// StatementResult holds the outcome of a single statement of a script
+type StatementResult struct {
+	Query        string          `json:"query"`
+	Line         int             `json:"line"`
+	Columns      []string        `json:"columns,omitempty"`
+	ColumnTypes  []ColumnInfo    `json:"column_types,omitempty"`
+	Rows         []Row           `json:"rows,omitempty"`
+	Truncated    bool            `json:"truncated,omitempty"`
+	RowsAffected int64           `json:"rows_affected"`
+	Duration     int64           `json:"duration_ms"`
+	Warning      string          `json:"warning,omitempty"`
+	Error        *StatementError `json:"error,omitempty"`
+}
+
+// StatementError describes why a statement failed and where it is located
+// in the script
+type StatementError struct {
+	Message string `json:"message"`
+	Line    int    `json:"line"`
+	Offset  int64  `json:"offset"`
+}
+
+// newStatementError locates the error of stmt within the script
+func newStatementError(stmt Statement, err error) *StatementError {
+	line := stmt.Line
+
+	match := errorLineRegex.FindStringSubmatch(err.Error())
+	if match != nil {
+		relative, _ := strconv.Atoi(match[1])
+		line += relative - 1
+	}
+
+	return &StatementError{
+		Message: err.Error(),
+		Line:    line,
+		Offset:  stmt.Offset,
+	}
+}
+
+// returnsRows reports whether the statement produces a resultset
+func returnsRows(sql string) bool {
+	return rowStatements[classifyStatement(sql).Type]
+}
+
+// RunScript executes the statements one after the other on the session
+// connection, so session state carries over between them. At most maxRows
+// rows are kept per statement. When stopOnError is set the statements
+// following a failed one are not executed.
+func (client *Client) RunScript(ctx context.Context, queryID string, statements []Statement, maxRows int, stopOnError bool) ([]StatementResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := []StatementResult{}
+
+	err := client.withSession(ctx, func(sessionCtx context.Context, conn *sqlx.Conn, threadID int64) error {
+		stop := client.watchQuery(ctx, queryID, threadID, cancel)
+		defer stop()
+
+		for _, stmt := range statements {
+			if ctx.Err() != nil {
+				break
+			}
+
+			result := StatementResult{
+				Query: stmt.SQL,
+				Line:  stmt.Line,
+			}
+
+			err := client.checkReadOnly(stmt.SQL)
+			if err != nil {
+				result.Error = newStatementError(stmt, err)
+				results = append(results, result)
+
+				if stopOnError {
+					break
+				}
+				continue
+			}
+
+			warning, err := client.checkSafeUpdate(stmt.SQL)
+			if err != nil {
+				result.Error = newStatementError(stmt, err)
+				results = append(results, result)
+
+				if stopOnError {
+					break
+				}
+				continue
+			}
+			result.Warning = warning
+
+			start := time.Now()
+			database := client.sessionDatabase()
+
+			entry := Query{Query: stmt.SQL, Database: database, Origin: OriginUser}
+
+			if returnsRows(stmt.SQL) {
+				err = client.runRowStatement(sessionCtx, conn, stmt.SQL, maxRows, &result)
+				entry.RowsReturned = int64(len(result.Rows))
+			} else {
+				result.RowsAffected, err = execContext(sessionCtx, conn, stmt.SQL)
+				if err == nil {
+					entry.RowsAffected = result.RowsAffected
+				}
+			}
+
+			client.recordExecution(entry, start, err)
+
+			result.Duration = time.Since(start).Milliseconds()
+			if err != nil {
+				result.Error = newStatementError(stmt, err)
+			} else {
+				client.trackSession(sessionCtx, conn, stmt.SQL)
+			}
+
+			results = append(results, result)
+
+			if isBadConn(err) {
+				return err
+			}
+
+			if err != nil && stopOnError {
+				break
+			}
+		}
+
+		return nil
+	})
+
+	// Losing the connection midway is reported in the statement results
+	if err != nil && len(results) == 0 {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// runRowStatement runs a statement producing a resultset and stores at most
+// maxRows of its rows in result
+func (client *Client) runRowStatement(ctx context.Context, conn *sqlx.Conn, query string, maxRows int, result *StatementResult) error {
+	rows, err := conn.QueryxContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+
+	result.ColumnTypes = columnInfos(columnTypes)
+	result.Columns = columnNames(result.ColumnTypes)
+
+	for rows.Next() {
+		if maxRows > 0 && len(result.Rows) >= maxRows {
+			result.Truncated = true
+			break
+		}
+
+		obj, err := scanRow(rows, result.ColumnTypes)
+		if err != nil {
+			return err
+		}
+
+		result.Rows = append(result.Rows, obj)
+	}
+
+	result.RowsAffected = int64(len(result.Rows))
+
+	return rows.Err()
+}
+
+// execContext runs a statement without resultset and returns the number of
+// affected rows
+func execContext(ctx context.Context, conn *sqlx.Conn, query string) (int64, error) {
+	res, err := conn.ExecContext(ctx, query)
+	if err != nil {
+		return -1, err
+	}
+
+	return res.RowsAffected()
+}
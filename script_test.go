@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReturnsRows(t *testing.T) {
+	assert.True(t, returnsRows("select * from t"))
+	assert.True(t, returnsRows("-- comment\n/* block */ (SELECT 1) UNION (SELECT 2)"))
+	assert.True(t, returnsRows("SHOW TABLES"))
+	assert.False(t, returnsRows("UPDATE t SET a = 1"))
+	assert.False(t, returnsRows("/*!40101 SET NAMES utf8 */"))
+	assert.False(t, returnsRows("-- only a comment"))
+	assert.True(t, returnsRows("# SELECT first\nWITH c AS (SELECT 1) SELECT * FROM c"))
+	assert.False(t, returnsRows("WITH c AS (SELECT id FROM t) DELETE FROM t WHERE id IN (SELECT id FROM c)"))
+	assert.False(t, returnsRows("/* SELECT */ UPDATE t SET a = 'SELECT'"))
+}
+
+func TestNewStatementError(t *testing.T) {
+	stmt := Statement{SQL: "SELECT\n1\nFROM", Line: 10, Offset: 120}
+	err := errors.New("Error 1064 (42000): You have an error in your SQL syntax; check the manual near '' at line 3")
+
+	stmtErr := newStatementError(stmt, err)
+
+	assert.Equal(t, 12, stmtErr.Line)
+	assert.Equal(t, int64(120), stmtErr.Offset)
+	assert.Equal(t, err.Error(), stmtErr.Message)
+
+	stmtErr = newStatementError(stmt, errors.New("Error 1146 (42S02): Table 'x.t' doesn't exist"))
+	assert.Equal(t, 10, stmtErr.Line)
+}
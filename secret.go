@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// secretPrefix marks the encrypted values, followed by the base64 encoding
+// of the nonce and the sealed value
+const secretPrefix = "enc:v1:"
+
+// ErrSecretKey is returned when an encrypted value can't be opened with the
+// key in use
+var ErrSecretKey = errors.New("Encrypted value can't be decrypted, check the bookmark key")
+
+// getKeyPath returns the path of the keyfile used when no master key is
+// given, creating its directory when missing
+func getKeyPath() string {
+	path, _ := homedir.Dir()
+	dir := filepath.Join(path, ".mysqlweb")
+
+	os.MkdirAll(dir, 0o700)
+
+	return filepath.Join(dir, "bookmark.key")
+}
+
+// secretKey returns the key encrypting the secrets of the bookmarks. It is
+// derived from the --bookmark-key option when set, or from the content of
+// the keyfile otherwise, which is generated on first use.
+func secretKey() ([]byte, error) {
+	if options.BookmarkKey != "" {
+		return deriveKey(options.BookmarkKey), nil
+	}
+
+	return readKeyFile(getKeyPath())
+}
+
+// readKeyFile reads the key from path, creating the file with a random key
+// when missing
+func readKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+
+		data = []byte(hex.EncodeToString(random) + "\n")
+
+		// Another process may be creating it too, the first one wins
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if os.IsExist(err) {
+			return readKeyFile(path)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = file.Write(data)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return nil, errors.New("Keyfile " + path + " is empty")
+	}
+
+	return deriveKey(key), nil
+}
+
+// deriveKey turns the master key into an AES-256 key
+func deriveKey(master string) []byte {
+	sum := sha256.Sum256([]byte(master))
+	return sum[:]
+}
+
+// encryptSecret seals value with AES-GCM under key
+func encryptSecret(key []byte, value string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret opens a value sealed by encryptSecret
+func decryptSecret(key []byte, value string) (string, error) {
+	if !strings.HasPrefix(value, secretPrefix) {
+		return "", errors.New("Value is not encrypted")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, secretPrefix))
+	if err != nil {
+		return "", ErrSecretKey
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return "", ErrSecretKey
+	}
+
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", ErrSecretKey
+	}
+
+	return string(plain), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+// ErrTooManySessions is returned when the registry is already holding the
+// maximum number of allowed sessions
+var ErrTooManySessions = errors.New("Maximum number of open connections reached")
+
+// session is a single registered client along with its connection details
+type session struct {
+	client   *Client
+	conn     Connection
+	lastUsed time.Time
+	// Number of requests in progress, the session doesn't expire meanwhile
+	busy int
+}
+
+// Registry keeps track of the open client connections. It is safe for
+// concurrent use by multiple goroutines.
+type Registry struct {
+	mu          sync.Mutex
+	sessions    map[string]*session
+	order       []string
+	idleTimeout time.Duration
+	maxSessions int
+}
+
+// NewRegistry creates an empty registry. A zero idleTimeout disables idle
+// expiry and a zero maxSessions means no limit.
+func NewRegistry(idleTimeout time.Duration, maxSessions int) *Registry {
+	return &Registry{
+		sessions:    make(map[string]*session),
+		idleTimeout: idleTimeout,
+		maxSessions: maxSessions,
+	}
+}
+
+// Add registers the client and returns the generated connection id
+func (r *Registry) Add(client *Client, conn Connection) (string, error) {
+	u4, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+
+	id := u4.String()
+	conn.ConnID = id
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.maxSessions > 0 && len(r.sessions) >= r.maxSessions {
+		return "", ErrTooManySessions
+	}
+
+	r.sessions[id] = &session{
+		client:   client,
+		conn:     conn,
+		lastUsed: time.Now(),
+	}
+	r.order = append(r.order, id)
+
+	return id, nil
+}
+
+// Get returns the client registered under id, or nil if there is none. The
+// session is marked as used.
+func (r *Registry) Get(id string) *Client {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok {
+		return nil
+	}
+
+	s.lastUsed = time.Now()
+
+	return s.client
+}
+
+// Acquire is Get for the length of a request: the session is kept from
+// expiring until the matching Release, however long the request runs.
+func (r *Registry) Acquire(id string) *Client {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok {
+		return nil
+	}
+
+	s.lastUsed = time.Now()
+	s.busy++
+
+	return s.client
+}
+
+// Release ends a request started with Acquire, the session being marked as
+// used
+func (r *Registry) Release(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok {
+		return
+	}
+
+	s.lastUsed = time.Now()
+	s.busy--
+}
+
+// Remove unregisters the client stored under id and returns it. The caller
+// is responsible for closing it.
+func (r *Registry) Remove(id string) *Client {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.remove(id)
+}
+
+func (r *Registry) remove(id string) *Client {
+	s, ok := r.sessions[id]
+	if !ok {
+		return nil
+	}
+
+	delete(r.sessions, id)
+	for index, element := range r.order {
+		if element == id {
+			r.order = append(r.order[:index], r.order[index+1:]...)
+			break
+		}
+	}
+
+	return s.client
+}
+
+// Connections returns the details of every registered connection in the
+// order they were added
+func (r *Registry) Connections() []Connection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	conns := make([]Connection, 0, len(r.order))
+	for _, id := range r.order {
+		conns = append(conns, r.sessions[id].conn)
+	}
+
+	return conns
+}
+
+// Len returns the number of registered sessions
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.sessions)
+}
+
+// Expire closes and removes every session that has not been used for longer
+// than the idle timeout, leaving out the ones serving a request. It returns
+// the ids of the expired sessions.
+func (r *Registry) Expire(now time.Time) []string {
+	if r.idleTimeout <= 0 {
+		return nil
+	}
+
+	var expired []*Client
+	var ids []string
+
+	r.mu.Lock()
+	for id, s := range r.sessions {
+		if s.busy == 0 && now.Sub(s.lastUsed) > r.idleTimeout {
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range ids {
+		expired = append(expired, r.remove(id))
+	}
+	r.mu.Unlock()
+
+	// Close outside of the lock, closing a pool may block on open connections
+	for _, client := range expired {
+		client.Close()
+	}
+
+	return ids
+}
+
+// StartReaper periodically expires idle sessions until stop is closed
+func (r *Registry) StartReaper(interval time.Duration, stop <-chan struct{}) {
+	if r.idleTimeout <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			r.Expire(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// CloseAll closes and removes every registered session
+func (r *Registry) CloseAll() {
+	r.mu.Lock()
+	clients := make([]*Client, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		clients = append(clients, s.client)
+	}
+	r.sessions = make(map[string]*session)
+	r.order = nil
+	r.mu.Unlock()
+
+	for _, client := range clients {
+		client.Close()
+	}
+}
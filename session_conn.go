@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// withSession runs fn on the connection dedicated to the interactive work of
+// the client, so session state (default database, variables, transactions)
+// is kept between queries. Calls are serialized. The connection is
+// re-established when it was lost, restoring the default database, unless
+// a transaction was open: ErrTransactionLost is returned then.
+//
+// fn must run its statements under the context it is given, which is never
+// cancelled: the driver closes the connection when the context of a
+// statement ends, rolling back the open transaction. Statements are stopped
+// with KILL QUERY instead, see watchQuery.
+func (client *Client) withSession(ctx context.Context, fn func(ctx context.Context, conn *sqlx.Conn, threadID int64) error) error {
+	client.connMu.Lock()
+	defer client.connMu.Unlock()
+
+	if err := client.ensureSession(ctx); err != nil {
+		return err
+	}
+
+	err := fn(context.WithoutCancel(ctx), client.conn, client.threadID)
+	if isBadConn(err) {
+		lost := client.InTransaction()
+		client.resetSession()
+
+		if lost {
+			return ErrTransactionLost
+		}
+	}
+
+	return err
+}
+
+// ensureSession opens the session connection if there is none or the
+// current one is not alive anymore. Must be called with connMu held.
+func (client *Client) ensureSession(ctx context.Context) error {
+	if client.conn != nil {
+		if err := client.conn.PingContext(context.WithoutCancel(ctx)); err == nil {
+			return nil
+		}
+
+		// Running the statement on a new connection would apply it outside
+		// of the transaction the user expects it in
+		lost := client.InTransaction()
+		client.resetSession()
+
+		if lost {
+			return ErrTransactionLost
+		}
+	}
+
+	conn, err := client.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+
+	var threadID int64
+	if err := conn.QueryRowxContext(ctx, MySQLConnectionID).Scan(&threadID); err != nil {
+		conn.Close()
+		return err
+	}
+
+	if client.readOnly {
+		if _, err := conn.ExecContext(ctx, MySQLSessionReadOnly); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	if client.database != "" {
+		_, err := conn.ExecContext(ctx, fmt.Sprintf(MySQLUseDatabase, quoteIdentifier(client.database)))
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	client.conn = conn
+	client.threadID = threadID
+
+	return nil
+}
+
+// resetSession drops the session connection. Must be called with connMu
+// held.
+func (client *Client) resetSession() {
+	if client.conn == nil {
+		return
+	}
+
+	// Never hand a connection with unknown session state back to the pool
+	client.conn.Raw(func(driverConn interface{}) error {
+		return driver.ErrBadConn
+	})
+	client.conn.Close()
+
+	client.conn = nil
+	client.threadID = 0
+
+	// The server rolls back the open transaction along with the connection
+	client.mu.Lock()
+	client.txStarted = time.Time{}
+	client.mu.Unlock()
+}
+
+// closeSession closes the session connection, waiting for the statement
+// running on it to finish. An open transaction is rolled back.
+func (client *Client) closeSession() {
+	client.connMu.Lock()
+	defer client.connMu.Unlock()
+
+	if client.conn != nil && client.InTransaction() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		client.conn.ExecContext(ctx, MySQLRollbackTransaction)
+		cancel()
+	}
+
+	client.resetSession()
+}
+
+// trackSession records the session state changed by a statement, i.e. the
+// transaction state and the default database to restore when reconnecting.
+// Must be called with connMu held.
+func (client *Client) trackSession(ctx context.Context, conn *sqlx.Conn, query string) {
+	client.trackTransaction(query)
+
+	if classifyStatement(query).Type != "USE" {
+		return
+	}
+
+	var database sql.NullString
+	if err := conn.QueryRowxContext(ctx, MySQLCurrentDatabase).Scan(&database); err == nil {
+		client.mu.Lock()
+		client.database = database.String
+		client.mu.Unlock()
+	}
+}
+
+// isBadConn reports whether err means the connection can't be used anymore
+func isBadConn(err error) bool {
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, sql.ErrConnDone)
+}
+
+// SessionQuery runs the query on the session connection and returns the
+// whole resultset
+func (client *Client) SessionQuery(ctx context.Context, query string, args ...interface{}) (*Result, error) {
+	var result *Result
+
+	err := client.withSession(ctx, func(ctx context.Context, conn *sqlx.Conn, threadID int64) error {
+		entry := Query{Query: query, Database: client.sessionDatabase(), Origin: OriginInternal}
+		start := time.Now()
+
+		rows, err := conn.QueryxContext(ctx, query, args...)
+		if err != nil {
+			client.recordExecution(entry, start, err)
+			return err
+		}
+		defer rows.Close()
+
+		result, err = readResult(rows)
+		if result != nil {
+			entry.RowsReturned = int64(len(result.Rows))
+		}
+
+		client.recordExecution(entry, start, err)
+		return err
+	})
+
+	return result, err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(t *testing.T) *Client {
+	client, err := NewClientFromURL("user:pass@tcp(localhost:3306)/db")
+	assert.NoError(t, err)
+
+	return client
+}
+
+func TestRegistry_AddGetRemove(t *testing.T) {
+	registry := NewRegistry(0, 0)
+	client := newTestClient(t)
+
+	id, err := registry.Add(client, Connection{Host: "localhost"})
+	assert.NoError(t, err)
+	assert.Equal(t, client, registry.Get(id))
+	assert.Equal(t, id, registry.Connections()[0].ConnID)
+
+	assert.Equal(t, client, registry.Remove(id))
+	assert.Nil(t, registry.Get(id))
+	assert.Equal(t, 0, registry.Len())
+}
+
+func TestRegistry_MaxSessions(t *testing.T) {
+	registry := NewRegistry(0, 1)
+
+	_, err := registry.Add(newTestClient(t), Connection{})
+	assert.NoError(t, err)
+
+	_, err = registry.Add(newTestClient(t), Connection{})
+	assert.Equal(t, ErrTooManySessions, err)
+}
+
+func TestRegistry_Expire(t *testing.T) {
+	registry := NewRegistry(time.Minute, 0)
+
+	idle, _ := registry.Add(newTestClient(t), Connection{})
+	active, _ := registry.Add(newTestClient(t), Connection{})
+
+	registry.sessions[idle].lastUsed = time.Now().Add(-time.Hour)
+
+	expired := registry.Expire(time.Now())
+
+	assert.Equal(t, []string{idle}, expired)
+	assert.Nil(t, registry.Get(idle))
+	assert.NotNil(t, registry.Get(active))
+}
+
+func TestRegistry_ExpireBusy(t *testing.T) {
+	registry := NewRegistry(time.Minute, 0)
+
+	id, _ := registry.Add(newTestClient(t), Connection{})
+	assert.NotNil(t, registry.Acquire(id))
+
+	registry.sessions[id].lastUsed = time.Now().Add(-time.Hour)
+	assert.Empty(t, registry.Expire(time.Now()))
+
+	// Releasing marks the session as used
+	registry.Release(id)
+	assert.Empty(t, registry.Expire(time.Now()))
+
+	assert.Equal(t, []string{id}, registry.Expire(time.Now().Add(time.Hour)))
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Largest sizes of the types proposed for sniffed columns
+const (
+	maxVarcharLength  = 255
+	maxTextBytes      = 1<<16 - 1
+	maxMediumTextSize = 1<<24 - 1
+	maxDecimalDigits  = 65
+	maxDecimalScale   = 30
+
+	// maxColumnName is the length limit of MySQL identifiers
+	maxColumnName = 64
+)
+
+var (
+	// Leading zeros are kept as text, e.g. zip codes or phone numbers
+	integerPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+	decimalPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?$`)
+	doublePattern  = regexp.MustCompile(`^-?((0|[1-9][0-9]*)(\.[0-9]*)?|\.[0-9]+)([eE][-+]?[0-9]+)?$`)
+)
+
+// SniffResult is the table proposed for a CSV file
+type SniffResult struct {
+	Columns   []TableColumn `json:"columns"`
+	Rows      int           `json:"rows"`
+	Statement string        `json:"statement"`
+}
+
+// columnSniffer infers the type of a column from its values. Every value
+// rules out the types it doesn't fit.
+type columnSniffer struct {
+	name      string
+	values    int
+	nulls     int
+	empties   int
+	maxLength int64
+	maxBytes  int64
+
+	integer   bool
+	fitsInt   bool
+	fitsInt64 bool
+	decimal   bool
+	intDigits int64
+	scale     int64
+	double    bool
+	date      bool
+	datetime  bool
+	fraction  int64
+	json      bool
+}
+
+func newColumnSniffer(name string) *columnSniffer {
+	return &columnSniffer{
+		name:      name,
+		integer:   true,
+		fitsInt:   true,
+		fitsInt64: true,
+		decimal:   true,
+		double:    true,
+		date:      true,
+		datetime:  true,
+		json:      true,
+	}
+}
+
+// add takes a value of the column into account, nil being NULL
+func (cs *columnSniffer) add(value interface{}) {
+	if value == nil {
+		cs.nulls++
+		return
+	}
+
+	text := value.(string)
+	if text == "" {
+		cs.empties++
+		return
+	}
+
+	cs.values++
+
+	if length := int64(utf8.RuneCountInString(text)); length > cs.maxLength {
+		cs.maxLength = length
+	}
+	if size := int64(len(text)); size > cs.maxBytes {
+		cs.maxBytes = size
+	}
+
+	if cs.integer && integerPattern.MatchString(text) {
+		if _, err := strconv.ParseInt(text, 10, 32); err != nil {
+			cs.fitsInt = false
+		}
+		if _, err := strconv.ParseInt(text, 10, 64); err != nil {
+			cs.fitsInt64 = false
+		}
+	} else {
+		cs.integer = false
+	}
+
+	if cs.decimal && decimalPattern.MatchString(text) {
+		digits := strings.TrimPrefix(text, "-")
+		scale := int64(0)
+		if point := strings.IndexByte(digits, '.'); point >= 0 {
+			scale = int64(len(digits) - point - 1)
+			digits = digits[:point]
+		}
+
+		if int64(len(digits)) > cs.intDigits {
+			cs.intDigits = int64(len(digits))
+		}
+		if scale > cs.scale {
+			cs.scale = scale
+		}
+	} else {
+		cs.decimal = false
+	}
+
+	if cs.double && doublePattern.MatchString(text) {
+		if _, err := strconv.ParseFloat(text, 64); err != nil {
+			cs.double = false
+		}
+	} else {
+		cs.double = false
+	}
+
+	if cs.date {
+		if _, err := time.Parse("2006-01-02", text); err != nil {
+			cs.date = false
+		}
+	}
+
+	if cs.datetime {
+		normalized := strings.Replace(text, "T", " ", 1)
+		if validDatetime(normalized) {
+			if point := strings.LastIndexByte(normalized, '.'); point > 0 && strings.Contains(normalized, ":") {
+				if fraction := int64(len(normalized) - point - 1); fraction > cs.fraction {
+					cs.fraction = fraction
+				}
+			}
+		} else {
+			cs.datetime = false
+		}
+	}
+
+	if cs.json && !((text[0] == '{' || text[0] == '[') && json.Valid([]byte(text))) {
+		cs.json = false
+	}
+}
+
+// column returns the column fitting every value, text when nothing else does
+func (cs *columnSniffer) column() TableColumn {
+	column := TableColumn{Name: cs.name, Nullable: cs.nulls > 0}
+
+	switch {
+	case cs.values == 0:
+		column.DataType = "varchar"
+		column.MaxLength = int64Ptr(maxVarcharLength)
+		column.Nullable = true
+		return column
+	case cs.integer && cs.fitsInt:
+		column.DataType = "int"
+	case cs.integer && cs.fitsInt64:
+		column.DataType = "bigint"
+	case cs.decimal && cs.intDigits+cs.scale <= maxDecimalDigits && cs.scale <= maxDecimalScale:
+		column.DataType = "decimal"
+		column.Precision = int64Ptr(cs.intDigits + cs.scale)
+		column.Scale = int64Ptr(cs.scale)
+	case cs.double:
+		column.DataType = "double"
+	case cs.date:
+		column.DataType = "date"
+	case cs.datetime:
+		column.DataType = "datetime"
+		if cs.fraction > 0 {
+			column.Precision = int64Ptr(min64(cs.fraction, 6))
+		}
+	case cs.json:
+		column.DataType = "json"
+	case cs.maxLength <= maxVarcharLength:
+		column.DataType = "varchar"
+		column.MaxLength = int64Ptr(cs.maxLength)
+	case cs.maxBytes <= maxTextBytes:
+		column.DataType = "text"
+	case cs.maxBytes <= maxMediumTextSize:
+		column.DataType = "mediumtext"
+	default:
+		column.DataType = "longtext"
+	}
+
+	// Empty fields are loaded as NULL in columns other than text ones
+	if cs.empties > 0 && !textDataTypes[column.DataType] {
+		column.Nullable = true
+	}
+
+	return column
+}
+
+func int64Ptr(n int64) *int64 {
+	return &n
+}
+
+func min64(a int64, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// truncateRunes returns the first n characters of s
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	return string([]rune(s)[:n])
+}
+
+// sniffColumnNames turns the header of a file into valid and unique column
+// names, naming the blank ones after their position
+func sniffColumnNames(header []string) []string {
+	names := make([]string, len(header))
+	seen := make(map[string]bool, len(header))
+
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+
+		unique := truncateRunes(name, maxColumnName)
+		for n := 2; seen[strings.ToLower(unique)]; n++ {
+			// The suffix must fit within the length limit too
+			suffix := fmt.Sprintf("_%d", n)
+			unique = truncateRunes(name, maxColumnName-len(suffix)) + suffix
+		}
+
+		seen[strings.ToLower(unique)] = true
+		names[i] = unique
+	}
+
+	return names
+}
+
+// sniffCSV reads the whole CSV file and returns the columns of a table able
+// to hold it, along with the number of rows
+func sniffCSV(source io.Reader, opts ImportOptions) ([]TableColumn, int, error) {
+	reader := csv.NewReader(source)
+	reader.Comma = opts.CSV.Delimiter
+
+	var sniffers []*columnSniffer
+	rows := 0
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if sniffers == nil {
+			header := make([]string, len(record))
+
+			if opts.CSV.Header {
+				copy(header, record)
+				header[0] = strings.TrimPrefix(header[0], "\ufeff")
+			}
+
+			for _, name := range sniffColumnNames(header) {
+				sniffers = append(sniffers, newColumnSniffer(name))
+			}
+
+			if opts.CSV.Header {
+				continue
+			}
+		}
+
+		rows++
+
+		for i, field := range record {
+			if opts.NullSet && field == opts.CSV.Null {
+				sniffers[i].add(nil)
+			} else {
+				sniffers[i].add(field)
+			}
+		}
+	}
+
+	if sniffers == nil {
+		return nil, 0, errors.New("File is empty")
+	}
+
+	columns := make([]TableColumn, len(sniffers))
+	for i, sniffer := range sniffers {
+		columns[i] = sniffer.column()
+	}
+
+	return columns, rows, nil
+}
+
+// columnDefinition returns the definition of the column in a CREATE TABLE
+// statement. Only the known data types are accepted, as the type can't be
+// quoted.
+func columnDefinition(column TableColumn) (string, error) {
+	dataType := strings.ToLower(column.DataType)
+	definition := strings.ToUpper(dataType)
+
+	switch dataType {
+	case "tinyint", "smallint", "mediumint", "int", "bigint", "float", "double",
+		"date", "time", "year", "json",
+		"tinytext", "text", "mediumtext", "longtext",
+		"tinyblob", "blob", "mediumblob", "longblob":
+	case "decimal":
+		if column.Precision != nil && column.Scale != nil {
+			definition += fmt.Sprintf("(%d,%d)", *column.Precision, *column.Scale)
+		}
+	case "datetime", "timestamp":
+		if column.Precision != nil && *column.Precision > 0 {
+			definition += fmt.Sprintf("(%d)", *column.Precision)
+		}
+	case "char", "varchar", "binary", "varbinary":
+		if column.MaxLength == nil || *column.MaxLength < 1 {
+			return "", fmt.Errorf("Column %s needs a length", column.Name)
+		}
+		definition += fmt.Sprintf("(%d)", *column.MaxLength)
+	default:
+		return "", fmt.Errorf("Unsupported data type %q for column %s", column.DataType, column.Name)
+	}
+
+	if column.Nullable {
+		definition += " NULL"
+	} else {
+		definition += " NOT NULL"
+	}
+
+	return quoteIdentifier(column.Name) + " " + definition, nil
+}
+
+// createTableStatement builds the CREATE TABLE statement of the columns
+func createTableStatement(database string, table string, columns []TableColumn) (string, error) {
+	if len(columns) == 0 {
+		return "", errors.New("Table needs at least one column")
+	}
+
+	definitions := make([]string, len(columns))
+
+	for i, column := range columns {
+		definition, err := columnDefinition(column)
+		if err != nil {
+			return "", err
+		}
+		definitions[i] = "  " + definition
+	}
+
+	return fmt.Sprintf(MySQLCreateTable, qualifiedName(database, table), strings.Join(definitions, ",\n")), nil
+}
+
+// seekable returns a source that can be read twice, copying it to a
+// temporary file when needed. The returned function removes the copy.
+func seekable(source io.Reader) (io.ReadSeeker, func(), error) {
+	if rs, ok := source.(io.ReadSeeker); ok {
+		return rs, func() {}, nil
+	}
+
+	file, err := os.CreateTemp("", "mysqlweb-import-*")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cleanup := func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+
+	if _, err := io.Copy(file, source); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	return file, cleanup, nil
+}
+
+// CreateTableFromFile creates the table from the columns sniffed from the
+// CSV file, or the given ones, and loads the file into it. The fields map
+// to the columns by position. The table is dropped if loading fails, and
+// only validated against the columns on dry runs.
+func (client *Client) CreateTableFromFile(ctx context.Context, database string, table string, source io.Reader, columns []TableColumn, opts ImportOptions) (*ImportSummary, error) {
+	if opts.Format != ImportCSV {
+		return nil, errors.New("Tables can only be created from CSV files")
+	}
+
+	file, cleanup, err := seekable(source)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	if columns == nil {
+		columns, _, err = sniffCSV(file, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	statement, err := createTableStatement(database, table, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.positional = true
+
+	if !opts.DryRun {
+		if _, err := client.Execute(statement); err != nil {
+			return nil, err
+		}
+	}
+
+	summary, err := client.importRows(ctx, database, table, columns, file, opts)
+
+	if !opts.DryRun && (err != nil || !summary.Committed) {
+		client.Execute(fmt.Sprintf(MySQLTableDrop, quoteIdentifier(database), quoteIdentifier(table)))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	summary.CreateStatement = statement
+
+	return summary, nil
+}
+
+// APISniffTable proposes the table holding an uploaded CSV file, sent the
+// same way as for imports
+func APISniffTable(c *gin.Context) {
+	source, params, filename, err := uploadedFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+	defer source.Close()
+
+	opts, err := parseImportOptions(params, filename)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	if opts.Format != ImportCSV {
+		c.JSON(http.StatusBadRequest, Error{"Only CSV files can be sniffed"})
+		return
+	}
+
+	columns, rows, err := sniffCSV(source, opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	statement, err := createTableStatement(c.Params.ByName("database"), c.Params.ByName("table"), columns)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, SniffResult{Columns: columns, Rows: rows, Statement: statement})
+}
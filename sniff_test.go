@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSniffCSV(t *testing.T) {
+	file := "id,price,zip,born,seen,meta,name,,name\n" +
+		"1,9.99,01234,2024-01-01,2024-01-01 10:00:00.25,\"{\"\"a\"\":1}\",Ann,x,\n" +
+		"3000000000,10,90210,2024-02-01,2024-02-01T11:00:00,[1],,y,b\n" +
+		",0.5,12345,,2024-03-01,{},Bob,z,c\n"
+
+	opts, err := parseImportOptions(nil, "")
+	assert.NoError(t, err)
+
+	columns, rows, err := sniffCSV(strings.NewReader(file), opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, rows)
+
+	expected := []TableColumn{
+		{Name: "id", DataType: "bigint", Nullable: true},
+		{Name: "price", DataType: "decimal", Precision: int64Ptr(4), Scale: int64Ptr(2)},
+		{Name: "zip", DataType: "varchar", MaxLength: int64Ptr(5)},
+		{Name: "born", DataType: "date", Nullable: true},
+		{Name: "seen", DataType: "datetime", Precision: int64Ptr(2)},
+		{Name: "meta", DataType: "json"},
+		{Name: "name", DataType: "varchar", MaxLength: int64Ptr(3)},
+		{Name: "column_8", DataType: "varchar", MaxLength: int64Ptr(1)},
+		{Name: "name_2", DataType: "varchar", MaxLength: int64Ptr(1)},
+	}
+	assert.Equal(t, expected, columns)
+}
+
+func TestSniffCSV_NoHeader(t *testing.T) {
+	opts := ImportOptions{Format: ImportCSV, CSV: DefaultCSVOptions(), NullSet: true}
+	opts.CSV.Header = false
+	opts.CSV.Null = `\N`
+
+	columns, rows, err := sniffCSV(strings.NewReader("1.5e3,\\N\n2,\\N\n"), opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rows)
+	assert.Equal(t, []TableColumn{
+		{Name: "column_1", DataType: "double"},
+		{Name: "column_2", DataType: "varchar", MaxLength: int64Ptr(255), Nullable: true},
+	}, columns)
+}
+
+func TestCreateTableStatement(t *testing.T) {
+	statement, err := createTableStatement("shop", "items", []TableColumn{
+		{Name: "id", DataType: "int"},
+		{Name: "price", DataType: "decimal", Precision: int64Ptr(6), Scale: int64Ptr(2), Nullable: true},
+		{Name: "name", DataType: "varchar", MaxLength: int64Ptr(20)},
+		{Name: "seen", DataType: "datetime", Precision: int64Ptr(3)},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE `shop`.`items` (\n"+
+		"  `id` INT NOT NULL,\n"+
+		"  `price` DECIMAL(6,2) NULL,\n"+
+		"  `name` VARCHAR(20) NOT NULL,\n"+
+		"  `seen` DATETIME(3) NOT NULL\n"+
+		")", statement)
+}
+
+func TestCreateTableStatement_Invalid(t *testing.T) {
+	_, err := createTableStatement("shop", "items", nil)
+	assert.Error(t, err)
+
+	_, err = createTableStatement("shop", "items", []TableColumn{{Name: "a", DataType: "int); DROP TABLE x; --"}})
+	assert.Error(t, err)
+
+	_, err = createTableStatement("shop", "items", []TableColumn{{Name: "a", DataType: "varchar"}})
+	assert.Error(t, err)
+}
+
+func TestSniffColumnNames(t *testing.T) {
+	names := sniffColumnNames([]string{" id ", "", "ID", strings.Repeat("a", 70)})
+
+	assert.Equal(t, []string{"id", "column_2", "ID_2", strings.Repeat("a", 64)}, names)
+
+	names = sniffColumnNames([]string{strings.Repeat("é", 70), strings.Repeat("é", 64)})
+	assert.Equal(t, []string{strings.Repeat("é", 64), strings.Repeat("é", 62) + "_2"}, names)
+}
@@ -0,0 +1,583 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mitchellh/go-homedir"
+)
+
+// snippetExportVersion is the version of the snippet library file format
+const snippetExportVersion = 1
+
+var (
+	// ErrSnippetNotFound is returned when no snippet has the given name
+	ErrSnippetNotFound = errors.New("Snippet not found")
+
+	// ErrSnippetExists is returned when creating a snippet under a name
+	// already taken
+	ErrSnippetExists = errors.New("A snippet with this name already exists")
+)
+
+// Snippet is a saved query. Its :name parameters are bound as values when it
+// is run.
+type Snippet struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Folder is a path of folder names separated by slashes
+	Folder  string   `json:"folder,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Query   string   `json:"query"`
+	Created int64    `json:"created,omitempty"`
+	Updated int64    `json:"updated,omitempty"`
+	// Parameters lists the parameters of the query, it is not stored
+	Parameters []string `json:"parameters,omitempty"`
+}
+
+// SnippetLibraryFile is the file the snippet library is exported to
+type SnippetLibraryFile struct {
+	Version  int       `json:"version"`
+	Snippets []Snippet `json:"snippets"`
+}
+
+// SnippetImportSummary tells which snippets of an imported library were
+// saved
+type SnippetImportSummary struct {
+	Imported []string `json:"imported"`
+	Skipped  []string `json:"skipped"`
+	Errors   []string `json:"errors"`
+}
+
+// SnippetFilter selects snippets, fields left empty matching any snippet.
+// Folder matches its subfolders as well.
+type SnippetFilter struct {
+	Folder string
+	Tag    string
+	Text   string
+}
+
+func (filter SnippetFilter) matches(snippet Snippet) bool {
+	if filter.Folder != "" && snippet.Folder != filter.Folder && !strings.HasPrefix(snippet.Folder, filter.Folder+"/") {
+		return false
+	}
+
+	if filter.Tag != "" {
+		found := false
+		for _, tag := range snippet.Tags {
+			if strings.EqualFold(tag, filter.Tag) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if filter.Text == "" {
+		return true
+	}
+
+	text := strings.ToLower(filter.Text)
+	for _, field := range []string{snippet.Name, snippet.Description, snippet.Query} {
+		if strings.Contains(strings.ToLower(field), text) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SnippetLibrary stores snippets as JSON files, one per snippet
+type SnippetLibrary struct {
+	dir string
+}
+
+// getSnippetPath returns the directory of the snippets, next to the bookmarks,
+// creating it when missing
+func getSnippetPath() string {
+	path, _ := homedir.Dir()
+	snippetPath := filepath.Join(path, ".mysqlweb", "snippets")
+
+	os.MkdirAll(snippetPath, 0o700)
+
+	return snippetPath
+}
+
+// NewSnippetLibrary opens the library stored in dir
+func NewSnippetLibrary(dir string) *SnippetLibrary {
+	return &SnippetLibrary{dir: dir}
+}
+
+// validate checks the snippet can be saved and normalizes its folder and tags
+func (snippet *Snippet) validate() error {
+	if !validSavedName(snippet.Name) {
+		return fmt.Errorf("Invalid snippet name %q: use letters, digits, spaces, dots, dashes and underscores", snippet.Name)
+	}
+
+	if strings.TrimSpace(snippet.Query) == "" {
+		return errors.New("Snippet query is empty")
+	}
+
+	var folders []string
+	for _, folder := range strings.Split(snippet.Folder, "/") {
+		folder = strings.TrimSpace(folder)
+		if folder == "" {
+			continue
+		}
+		if !validSavedName(folder) {
+			return fmt.Errorf("Invalid folder name %q", folder)
+		}
+		folders = append(folders, folder)
+	}
+	snippet.Folder = strings.Join(folders, "/")
+
+	var tags []string
+	seen := map[string]bool{}
+	for _, tag := range snippet.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		tags = append(tags, tag)
+	}
+	snippet.Tags = tags
+
+	return nil
+}
+
+func (lib *SnippetLibrary) path(name string) string {
+	return filepath.Join(lib.dir, name+".json")
+}
+
+// List returns the snippets selected by the filter, by folder and name
+func (lib *SnippetLibrary) List(filter SnippetFilter) ([]Snippet, error) {
+	files, err := os.ReadDir(lib.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	snippets := []Snippet{}
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		snippet, err := lib.Get(fileBaseName(file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		if filter.matches(*snippet) {
+			snippets = append(snippets, *snippet)
+		}
+	}
+
+	sort.Slice(snippets, func(i, j int) bool {
+		if snippets[i].Folder != snippets[j].Folder {
+			return snippets[i].Folder < snippets[j].Folder
+		}
+		return snippets[i].Name < snippets[j].Name
+	})
+
+	return snippets, nil
+}
+
+// Get returns the snippet with the given name
+func (lib *SnippetLibrary) Get(name string) (*Snippet, error) {
+	if !validSavedName(name) {
+		return nil, ErrSnippetNotFound
+	}
+
+	data, err := os.ReadFile(lib.path(name))
+	if os.IsNotExist(err) {
+		return nil, ErrSnippetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snippet Snippet
+	if err := json.Unmarshal(data, &snippet); err != nil {
+		return nil, fmt.Errorf("Snippet %s is corrupt: %s", name, err)
+	}
+
+	snippet.Name = name
+	snippet.Parameters = snippetParameters(snippet.Query)
+
+	return &snippet, nil
+}
+
+// Save stores the snippet. A new snippet can't replace an existing one and
+// an updated one must exist.
+func (lib *SnippetLibrary) Save(snippet Snippet, create bool) (*Snippet, error) {
+	if err := snippet.validate(); err != nil {
+		return nil, err
+	}
+
+	existing, err := lib.Get(snippet.Name)
+	switch {
+	case err == ErrSnippetNotFound:
+		if !create {
+			return nil, err
+		}
+		snippet.Created = time.Now().Unix()
+	case err != nil:
+		return nil, err
+	case create:
+		return nil, ErrSnippetExists
+	default:
+		snippet.Created = existing.Created
+	}
+
+	snippet.Updated = time.Now().Unix()
+	snippet.Parameters = nil
+
+	data, err := json.MarshalIndent(snippet, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeFileAtomic(lib.path(snippet.Name), data, 0o600); err != nil {
+		return nil, err
+	}
+
+	snippet.Parameters = snippetParameters(snippet.Query)
+
+	return &snippet, nil
+}
+
+// Delete removes the snippet
+func (lib *SnippetLibrary) Delete(name string) error {
+	if !validSavedName(name) {
+		return ErrSnippetNotFound
+	}
+
+	err := os.Remove(lib.path(name))
+	if os.IsNotExist(err) {
+		return ErrSnippetNotFound
+	}
+
+	return err
+}
+
+// Import saves the snippets of a library file. Existing snippets are
+// replaced only when overwrite is set, skipped otherwise.
+func (lib *SnippetLibrary) Import(file SnippetLibraryFile, overwrite bool) (*SnippetImportSummary, error) {
+	if file.Version > snippetExportVersion {
+		return nil, fmt.Errorf("Unsupported snippet library version %d", file.Version)
+	}
+
+	summary := &SnippetImportSummary{Imported: []string{}, Skipped: []string{}, Errors: []string{}}
+
+	for _, snippet := range file.Snippets {
+		_, err := lib.Get(snippet.Name)
+		exists := err == nil
+
+		if exists && !overwrite {
+			summary.Skipped = append(summary.Skipped, snippet.Name)
+			continue
+		}
+
+		if _, err := lib.Save(snippet, !exists); err != nil {
+			summary.Errors = append(summary.Errors, fmt.Sprintf("%s: %s", snippet.Name, err))
+			continue
+		}
+
+		summary.Imported = append(summary.Imported, snippet.Name)
+	}
+
+	return summary, nil
+}
+
+// parseParameters replaces the :name parameters of the query with ?
+// placeholders and returns their names, in order of appearance. Strings,
+// quoted identifiers and comments are left untouched.
+func parseParameters(query string) (string, []string) {
+	var out strings.Builder
+	var names []string
+
+	for i := 0; i < len(query); {
+		c := query[i]
+
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := quotedEnd(query, i)
+			out.WriteString(query[i:end])
+			i = end
+		case c == '#' || (strings.HasPrefix(query[i:], "--") && (i+2 == len(query) || isBlank(rune(query[i+2])))):
+			end := strings.IndexByte(query[i:], '\n')
+			if end == -1 {
+				end = len(query) - i
+			}
+			out.WriteString(query[i : i+end])
+			i += end
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end == -1 {
+				end = len(query) - i
+			} else {
+				end += 4
+			}
+			out.WriteString(query[i : i+end])
+			i += end
+		case c == ':' && i+1 < len(query) && isParameterStart(query[i+1]) && (i == 0 || (!isParameterChar(query[i-1]) && query[i-1] != ':')):
+			end := i + 1
+			for end < len(query) && isParameterChar(query[end]) {
+				end++
+			}
+			names = append(names, query[i+1:end])
+			out.WriteByte('?')
+			i = end
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+
+	return out.String(), names
+}
+
+// quotedEnd returns the index following the string or quoted identifier
+// starting at start
+func quotedEnd(query string, start int) int {
+	quote := query[start]
+
+	for i := start + 1; i < len(query); i++ {
+		switch {
+		case query[i] == '\\' && quote != '`':
+			i++
+		case query[i] == quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+
+	return len(query)
+}
+
+func isParameterStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isParameterChar(c byte) bool {
+	return isParameterStart(c) || (c >= '0' && c <= '9')
+}
+
+// snippetParameters returns the distinct parameters of the query
+func snippetParameters(query string) []string {
+	_, names := parseParameters(query)
+
+	var parameters []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			parameters = append(parameters, name)
+		}
+	}
+
+	return parameters
+}
+
+// snippetSQL returns the query with ? placeholders and the values to bind
+// to them, a parameter used several times being bound each time
+func snippetSQL(query string, values map[string]string) (string, []interface{}, error) {
+	sql, names := parseParameters(query)
+	parameters := snippetParameters(query)
+
+	for name := range values {
+		found := false
+		for _, parameter := range parameters {
+			if parameter == name {
+				found = true
+			}
+		}
+		if !found {
+			return "", nil, fmt.Errorf("Unknown parameter %s", name)
+		}
+	}
+
+	var missing []string
+	for _, name := range parameters {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", nil, fmt.Errorf("Missing values for parameters: %s", strings.Join(missing, ", "))
+	}
+
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		args[i] = values[name]
+	}
+
+	return sql, args, nil
+}
+
+// snippetStatus returns the status of a failed snippet operation
+func snippetStatus(err error) int {
+	switch err {
+	case ErrSnippetNotFound:
+		return http.StatusNotFound
+	case ErrSnippetExists:
+		return http.StatusConflict
+	}
+
+	return http.StatusBadRequest
+}
+
+// APIGetSnippets lists the snippets, filtered by the folder, tag and q
+// parameters
+func APIGetSnippets(c *gin.Context) {
+	filter := SnippetFilter{
+		Folder: strings.Trim(c.Query("folder"), "/"),
+		Tag:    c.Query("tag"),
+		Text:   c.Query("q"),
+	}
+
+	snippets, err := NewSnippetLibrary(getSnippetPath()).List(filter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, snippets)
+}
+
+// APIGetSnippet returns a snippet
+func APIGetSnippet(c *gin.Context) {
+	snippet, err := NewSnippetLibrary(getSnippetPath()).Get(c.Params.ByName("name"))
+	if err != nil {
+		c.JSON(snippetStatus(err), NewError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, snippet)
+}
+
+// apiSaveSnippet stores the snippet sent as JSON under the name of the route
+func apiSaveSnippet(c *gin.Context, create bool) {
+	var snippet Snippet
+	if err := json.NewDecoder(c.Request.Body).Decode(&snippet); err != nil {
+		c.JSON(http.StatusBadRequest, Error{"Invalid JSON body"})
+		return
+	}
+	snippet.Name = c.Params.ByName("name")
+
+	saved, err := NewSnippetLibrary(getSnippetPath()).Save(snippet, create)
+	if err != nil {
+		c.JSON(snippetStatus(err), NewError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, saved)
+}
+
+// APICreateSnippet creates a snippet
+func APICreateSnippet(c *gin.Context) {
+	apiSaveSnippet(c, true)
+}
+
+// APIUpdateSnippet replaces an existing snippet
+func APIUpdateSnippet(c *gin.Context) {
+	apiSaveSnippet(c, false)
+}
+
+// APIDeleteSnippet deletes a snippet
+func APIDeleteSnippet(c *gin.Context) {
+	err := NewSnippetLibrary(getSnippetPath()).Delete(c.Params.ByName("name"))
+	if err != nil {
+		c.JSON(snippetStatus(err), NewError(err))
+		return
+	}
+
+	c.Writer.WriteHeader(http.StatusNoContent)
+}
+
+// APIExportSnippets downloads the whole snippet library as a single JSON file
+func APIExportSnippets(c *gin.Context) {
+	snippets, err := NewSnippetLibrary(getSnippetPath()).List(SnippetFilter{})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	for i := range snippets {
+		snippets[i].Parameters = nil
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "snippets.json"}))
+	c.JSON(http.StatusOK, SnippetLibraryFile{Version: snippetExportVersion, Snippets: snippets})
+}
+
+// APIImportSnippets loads a library file exported by APIExportSnippets, sent
+// in the file field of a multipart form or as the raw request body. Existing
+// snippets are replaced with overwrite=true, skipped otherwise.
+func APIImportSnippets(c *gin.Context) {
+	source, params, _, err := uploadedFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+	defer source.Close()
+
+	overwrite := false
+	if value := params.Get("overwrite"); value != "" {
+		overwrite, err = strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Error{"Invalid overwrite value"})
+			return
+		}
+	}
+
+	var file SnippetLibraryFile
+	if err := json.NewDecoder(io.LimitReader(source, 10*MEGABYTE)).Decode(&file); err != nil {
+		c.JSON(http.StatusBadRequest, Error{"Invalid snippet library file"})
+		return
+	}
+
+	summary, err := NewSnippetLibrary(getSnippetPath()).Import(file, overwrite)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// APIRunSnippet runs a snippet on the current connection, the values of its
+// parameters being given as params[name]=value form values. Values are
+// bound, never inserted in the query text. The response is the one of
+// APIRunQuery.
+func APIRunSnippet(c *gin.Context) {
+	snippet, err := NewSnippetLibrary(getSnippetPath()).Get(c.Params.ByName("name"))
+	if err != nil {
+		c.JSON(snippetStatus(err), NewError(err))
+		return
+	}
+
+	query, args, err := snippetSQL(snippet.Query, c.PostFormMap("params"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewError(err))
+		return
+	}
+
+	APIHandleQuery(query, c, args...)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseParameters(t *testing.T) {
+	query := "SELECT * FROM t WHERE a = :id AND b = ':skip' AND c = `:col` -- :comment\n" +
+		"AND d = :id /* :block */ AND e = @v := :value_2 AND f = 'it''s :x' AND g = \"\\\":y\""
+
+	sql, names := parseParameters(query)
+
+	assert.Equal(t, "SELECT * FROM t WHERE a = ? AND b = ':skip' AND c = `:col` -- :comment\n"+
+		"AND d = ? /* :block */ AND e = @v := ? AND f = 'it''s :x' AND g = \"\\\":y\"", sql)
+	assert.Equal(t, []string{"id", "id", "value_2"}, names)
+	assert.Equal(t, []string{"id", "value_2"}, snippetParameters(query))
+}
+
+func TestSnippetSQL(t *testing.T) {
+	sql, args, err := snippetSQL("SELECT :a, :b, :a", map[string]string{"a": "1", "b": "x'); DROP TABLE t; --"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT ?, ?, ?", sql)
+	assert.Equal(t, []interface{}{"1", "x'); DROP TABLE t; --", "1"}, args)
+
+	_, _, err = snippetSQL("SELECT :a, :b", map[string]string{"a": "1"})
+	assert.EqualError(t, err, "Missing values for parameters: b")
+
+	_, _, err = snippetSQL("SELECT :a", map[string]string{"a": "1", "c": "2"})
+	assert.EqualError(t, err, "Unknown parameter c")
+}
+
+func TestSnippetLibrary(t *testing.T) {
+	lib := NewSnippetLibrary(t.TempDir())
+
+	saved, err := lib.Save(Snippet{
+		Name:   "Active users",
+		Folder: " reports / users/",
+		Tags:   []string{"daily", " Daily", ""},
+		Query:  "SELECT * FROM users WHERE active = :active",
+	}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "reports/users", saved.Folder)
+	assert.Equal(t, []string{"daily"}, saved.Tags)
+	assert.Equal(t, []string{"active"}, saved.Parameters)
+
+	_, err = lib.Save(Snippet{Name: "Active users", Query: "SELECT 1"}, true)
+	assert.Equal(t, ErrSnippetExists, err)
+
+	_, err = lib.Save(Snippet{Name: "Missing", Query: "SELECT 1"}, false)
+	assert.Equal(t, ErrSnippetNotFound, err)
+
+	_, err = lib.Save(Snippet{Name: "../escape", Query: "SELECT 1"}, true)
+	assert.Error(t, err)
+
+	_, err = lib.Save(Snippet{Name: "Orders", Folder: "reports", Query: "SELECT * FROM orders"}, true)
+	assert.NoError(t, err)
+
+	snippets, err := lib.List(SnippetFilter{Folder: "reports"})
+	assert.NoError(t, err)
+	assert.Len(t, snippets, 2)
+	assert.Equal(t, "Orders", snippets[0].Name)
+
+	snippets, err = lib.List(SnippetFilter{Tag: "DAILY", Text: "users"})
+	assert.NoError(t, err)
+	assert.Len(t, snippets, 1)
+
+	assert.NoError(t, lib.Delete("Orders"))
+	assert.Equal(t, ErrSnippetNotFound, lib.Delete("Orders"))
+}
+
+func TestSnippetLibraryImport(t *testing.T) {
+	lib := NewSnippetLibrary(t.TempDir())
+
+	_, err := lib.Save(Snippet{Name: "a", Query: "SELECT 1"}, true)
+	assert.NoError(t, err)
+
+	file := SnippetLibraryFile{
+		Version: snippetExportVersion,
+		Snippets: []Snippet{
+			{Name: "a", Query: "SELECT 2"},
+			{Name: "b", Query: "SELECT 3"},
+			{Name: "c/d", Query: "SELECT 4"},
+		},
+	}
+
+	summary, err := lib.Import(file, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, summary.Imported)
+	assert.Equal(t, []string{"a"}, summary.Skipped)
+	assert.Len(t, summary.Errors, 1)
+
+	summary, err = lib.Import(file, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, summary.Imported)
+
+	snippet, err := lib.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT 2", snippet.Query)
+
+	_, err = lib.Import(SnippetLibraryFile{Version: snippetExportVersion + 1}, false)
+	assert.Error(t, err)
+}
+
+func TestSnippetStatus(t *testing.T) {
+	assert.Equal(t, http.StatusNotFound, snippetStatus(ErrSnippetNotFound))
+	assert.Equal(t, http.StatusConflict, snippetStatus(ErrSnippetExists))
+	assert.Equal(t, http.StatusBadRequest, snippetStatus(errors.New("Invalid snippet")))
+}
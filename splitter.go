@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// DefaultDelimiter is the statement delimiter used until a DELIMITER command
+// changes it
+const DefaultDelimiter = ";"
+
+// Statement is a single statement read from a SQL script
+type Statement struct {
+	SQL    string `json:"query"`
+	Line   int    `json:"line"`
+	Offset int64  `json:"offset"`
+}
+
+// Lexer states of the StatementScanner
+const (
+	stateCode = iota
+	stateSingleQuote
+	stateDoubleQuote
+	stateBacktick
+	stateLineComment
+	stateBlockComment
+)
+
+// StatementScanner reads the statements of a SQL script one at a time. It
+// understands strings, quoted identifiers, comments and the DELIMITER
+// command of the mysql client, so procedure bodies are kept in one piece.
+// The script is read incrementally, only the current statement is held in
+// memory.
+type StatementScanner struct {
+	r         *bufio.Reader
+	delimiter string
+
+	// Position of the next rune to be read and size of the last one
+	line   int
+	offset int64
+	size   int
+
+	buf     strings.Builder
+	state   int
+	hasCode bool
+	start   Statement
+
+	// Minimum buffer length at which the current block comment can end
+	commentEnd int
+}
+
+// NewStatementScanner creates a scanner reading the script from r
+func NewStatementScanner(r io.Reader) *StatementScanner {
+	return &StatementScanner{
+		r:         bufio.NewReader(r),
+		delimiter: DefaultDelimiter,
+		line:      1,
+	}
+}
+
+// Line returns the number of the line being read
+func (s *StatementScanner) Line() int {
+	return s.line
+}
+
+// Offset returns the number of bytes read so far
+func (s *StatementScanner) Offset() int64 {
+	return s.offset
+}
+
+// Next returns the next statement of the script, or io.EOF once there are
+// none left. A last statement without delimiter is returned as well.
+func (s *StatementScanner) Next() (Statement, error) {
+	for {
+		if s.state == stateCode && !s.hasCode && s.atLineStart() {
+			isDelimiter, err := s.readDelimiterCommand()
+			if err != nil && err != io.EOF {
+				return Statement{}, err
+			}
+			if isDelimiter {
+				continue
+			}
+		}
+
+		r, err := s.read()
+		if err == io.EOF {
+			stmt, ok := s.flush("")
+			if ok {
+				return stmt, nil
+			}
+			return Statement{}, io.EOF
+		}
+		if err != nil {
+			return Statement{}, err
+		}
+
+		if s.buf.Len() == 0 && unicode.IsSpace(r) {
+			continue
+		}
+
+		if s.buf.Len() == 0 {
+			s.start = Statement{Line: s.line, Offset: s.offset - int64(s.size)}
+		}
+
+		s.buf.WriteRune(r)
+
+		switch s.state {
+		case stateCode:
+			if stmt, ok := s.code(r); ok {
+				return stmt, nil
+			}
+		case stateSingleQuote, stateDoubleQuote:
+			quote := '\''
+			if s.state == stateDoubleQuote {
+				quote = '"'
+			}
+
+			if r == '\\' {
+				// Escaped character, keep it as it is
+				next, err := s.read()
+				if err == nil {
+					s.buf.WriteRune(next)
+				}
+			} else if r == quote {
+				s.state = stateCode
+			}
+		case stateBacktick:
+			if r == '`' {
+				s.state = stateCode
+			}
+		case stateLineComment:
+			if r == '\n' {
+				s.state = stateCode
+			}
+		case stateBlockComment:
+			if r == '/' && s.buf.Len() >= s.commentEnd && strings.HasSuffix(s.buf.String(), "*/") {
+				s.state = stateCode
+			}
+		}
+	}
+}
+
+// code handles a rune read outside of strings and comments. It reports
+// whether it completed a statement.
+func (s *StatementScanner) code(r rune) (Statement, bool) {
+	switch {
+	case r == '\'':
+		s.state = stateSingleQuote
+	case r == '"':
+		s.state = stateDoubleQuote
+	case r == '`':
+		s.state = stateBacktick
+	case r == '#':
+		s.state = stateLineComment
+		return Statement{}, false
+	case r == '-' && s.peekLineComment():
+		s.state = stateLineComment
+		return Statement{}, false
+	case r == '/' && s.peek(1) == "*":
+		s.buf.WriteRune(s.mustRead())
+		s.state = stateBlockComment
+		s.commentEnd = s.buf.Len() + 2
+
+		// Conditional comments (/*! ... */) are executed by the server
+		if s.peek(1) == "!" {
+			s.hasCode = true
+		}
+		return Statement{}, false
+	}
+
+	if strings.HasSuffix(s.buf.String(), s.delimiter) {
+		return s.flush(s.delimiter)
+	}
+
+	if !unicode.IsSpace(r) {
+		s.hasCode = true
+	}
+
+	return Statement{}, false
+}
+
+// flush returns the buffered statement, without its delimiter, and resets
+// the buffer. Statements made only of comments are dropped.
+func (s *StatementScanner) flush(delimiter string) (Statement, bool) {
+	sql := strings.TrimSuffix(s.buf.String(), delimiter)
+	hasCode := s.hasCode
+
+	s.buf.Reset()
+	s.hasCode = false
+	s.state = stateCode
+
+	sql = strings.TrimSpace(sql)
+	if !hasCode || sql == "" {
+		return Statement{}, false
+	}
+
+	stmt := s.start
+	stmt.SQL = sql
+
+	return stmt, true
+}
+
+// atLineStart reports whether the buffer only holds whitespace and comments
+// ending with a line break, i.e. a client command may follow
+func (s *StatementScanner) atLineStart() bool {
+	content := s.buf.String()
+	return content == "" || strings.HasSuffix(content, "\n")
+}
+
+// readDelimiterCommand consumes a DELIMITER command if one follows
+func (s *StatementScanner) readDelimiterCommand() (bool, error) {
+	const keyword = "delimiter"
+
+	head, err := s.r.Peek(len(keyword) + 1)
+	if len(head) < len(keyword)+1 {
+		return false, err
+	}
+
+	if !strings.EqualFold(string(head[:len(keyword)]), keyword) || !isBlank(rune(head[len(keyword)])) {
+		return false, nil
+	}
+
+	line, err := s.r.ReadString('\n')
+	s.offset += int64(len(line))
+	if strings.HasSuffix(line, "\n") {
+		s.line++
+	}
+
+	fields := strings.Fields(line[len(keyword):])
+	if len(fields) > 0 {
+		s.delimiter = fields[0]
+	}
+
+	// Comments preceding the command are not part of any statement
+	s.buf.Reset()
+
+	return true, err
+}
+
+// peekLineComment reports whether the "-" just read starts a "-- " comment
+func (s *StatementScanner) peekLineComment() bool {
+	next := s.peek(2)
+	if len(next) == 0 || next[0] != '-' {
+		return false
+	}
+
+	return len(next) == 1 || isBlank(rune(next[1])) || next[1] == '\n'
+}
+
+func (s *StatementScanner) peek(n int) string {
+	data, _ := s.r.Peek(n)
+	return string(data)
+}
+
+func (s *StatementScanner) read() (rune, error) {
+	r, size, err := s.r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+
+	s.offset += int64(size)
+	s.size = size
+	if r == '\n' {
+		s.line++
+	}
+
+	return r, nil
+}
+
+func (s *StatementScanner) mustRead() rune {
+	r, _ := s.read()
+	return r
+}
+
+func isBlank(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\r'
+}
+
+// splitStatements splits a SQL script into its statements
+func splitStatements(script string) ([]Statement, error) {
+	scanner := NewStatementScanner(strings.NewReader(script))
+
+	var statements []Statement
+
+	for {
+		stmt, err := scanner.Next()
+		if err == io.EOF {
+			return statements, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		statements = append(statements, stmt)
+	}
+}
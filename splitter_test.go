@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func statementSQL(statements []Statement) []string {
+	var sql []string
+	for _, stmt := range statements {
+		sql = append(sql, stmt.SQL)
+	}
+	return sql
+}
+
+func TestSplitStatements(t *testing.T) {
+	statements, err := splitStatements("SELECT 1;\nSELECT 2;  SELECT 3")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"SELECT 1", "SELECT 2", "SELECT 3"}, statementSQL(statements))
+	assert.Equal(t, 1, statements[0].Line)
+	assert.Equal(t, 2, statements[1].Line)
+	assert.Equal(t, int64(10), statements[1].Offset)
+	assert.Equal(t, int64(21), statements[2].Offset)
+}
+
+func TestSplitStatements_Strings(t *testing.T) {
+	script := `INSERT INTO t VALUES ('a;b', "c;d", 'it''s;', 'x\';y');` + "\nSELECT `we;ird` FROM t;"
+	statements, err := splitStatements(script)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`INSERT INTO t VALUES ('a;b', "c;d", 'it''s;', 'x\';y')`,
+		"SELECT `we;ird` FROM t",
+	}, statementSQL(statements))
+}
+
+func TestSplitStatements_Comments(t *testing.T) {
+	script := "-- first; comment\nSELECT 1; # trailing; comment\n/* block; */ SELECT 2;\nSELECT 3--1;\n-- only a comment"
+	statements, err := splitStatements(script)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"-- first; comment\nSELECT 1",
+		"# trailing; comment\n/* block; */ SELECT 2",
+		"SELECT 3--1",
+	}, statementSQL(statements))
+	assert.Equal(t, 1, statements[0].Line)
+}
+
+func TestSplitStatements_ConditionalComment(t *testing.T) {
+	statements, err := splitStatements("/*!40101 SET NAMES utf8 */;\n/* just a comment */;")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/*!40101 SET NAMES utf8 */"}, statementSQL(statements))
+}
+
+func TestSplitStatements_Delimiter(t *testing.T) {
+	script := `DROP PROCEDURE IF EXISTS p;
+DELIMITER $$
+CREATE PROCEDURE p()
+BEGIN
+  SELECT 1;
+  SELECT 2;
+END$$
+delimiter ;
+CALL p();`
+	statements, err := splitStatements(script)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"DROP PROCEDURE IF EXISTS p",
+		"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND",
+		"CALL p()",
+	}, statementSQL(statements))
+	assert.Equal(t, 3, statements[1].Line)
+	assert.Equal(t, 9, statements[2].Line)
+}
+
+func TestSplitStatements_Unicode(t *testing.T) {
+	statements, err := splitStatements("SELECT 'ñandú';\nSELECT '日本';")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"SELECT 'ñandú'", "SELECT '日本'"}, statementSQL(statements))
+	assert.Equal(t, int64(len("SELECT 'ñandú';\n")), statements[1].Offset)
+}
@@ -1,25 +1,56 @@
 package main
 
+// Statements below use ? placeholders for values and %s for identifiers. The
+// identifiers must be escaped with quoteIdentifier before being formatted in.
 const (
-	MySQLInfo                = "SELECT VERSION(), USER(), DATABASE()"
+	MySQLInfo                = "SELECT VERSION(), USER(), ? AS `DATABASE()`"
+	MySQLConnectionID        = "SELECT CONNECTION_ID()"
+	MySQLCurrentDatabase     = "SELECT DATABASE()"
+	MySQLKillQuery           = "KILL QUERY %d"
 	MySQLDatabases           = "SELECT SCHEMA_NAME, DEFAULT_CHARACTER_SET_NAME, DEFAULT_COLLATION_NAME FROM information_schema.SCHEMATA ORDER BY schema_name;"
-	MySQLDatabaseTables      = "SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = '%s' AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME;"
-	MySQLDatabaseViews       = "SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = '%s' AND TABLE_TYPE = 'VIEW' ORDER BY TABLE_NAME;"
-	MySQLDatabaseProcedures  = "SELECT ROUTINE_NAME FROM INFORMATION_SCHEMA.ROUTINES WHERE ROUTINE_TYPE= 'PROCEDURE' AND ROUTINE_SCHEMA= '%s' ORDER BY ROUTINE_NAME;"
-	MySQLDatabaseFunctions   = "SELECT ROUTINE_NAME FROM INFORMATION_SCHEMA.ROUTINES WHERE ROUTINE_TYPE= 'FUNCTION' AND ROUTINE_SCHEMA= '%s' ORDER BY ROUTINE_NAME;"
-	MySQLTableInfo           = "SELECT DATA_LENGTH AS data_length, INDEX_LENGTH AS index_length, (DATA_LENGTH + INDEX_LENGTH) AS total_size, TABLE_ROWS AS row_count FROM information_schema.TABLES WHERE TABLE_NAME = '%s';"
-	MySQLTableIndexs         = "SELECT INDEX_NAME, INDEX_TYPE FROM information_schema.statistics WHERE TABLE_NAME = '%s';"
-	MySQLTableColumns        = "SELECT COLUMN_NAME, DATA_TYPE, IS_NULLABLE, CHARACTER_MAXIMUM_LENGTH, CHARACTER_SET_NAME, COLUMN_DEFAULT FROM information_schema.columns WHERE TABLE_SCHEMA = '%s' AND TABLE_NAME = '%s';"
-	MySQLProcedureParameters = "SELECT PARAMETER_MODE, PARAMETER_NAME, DATA_TYPE, ORDINAL_POSITION FROM information_schema.parameters where SPECIFIC_NAME = '%s' and SPECIFIC_SCHEMA = '%s' order by ORDINAL_POSITION"
+	MySQLDatabaseTables      = "SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME;"
+	MySQLDatabaseViews       = "SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'VIEW' ORDER BY TABLE_NAME;"
+	MySQLDatabaseProcedures  = "SELECT ROUTINE_NAME FROM INFORMATION_SCHEMA.ROUTINES WHERE ROUTINE_TYPE= 'PROCEDURE' AND ROUTINE_SCHEMA= ? ORDER BY ROUTINE_NAME;"
+	MySQLDatabaseFunctions   = "SELECT ROUTINE_NAME FROM INFORMATION_SCHEMA.ROUTINES WHERE ROUTINE_TYPE= 'FUNCTION' AND ROUTINE_SCHEMA= ? ORDER BY ROUTINE_NAME;"
+	MySQLTableInfo           = "SELECT DATA_LENGTH AS data_length, INDEX_LENGTH AS index_length, (DATA_LENGTH + INDEX_LENGTH) AS total_size, TABLE_ROWS AS row_count FROM information_schema.TABLES WHERE TABLE_NAME = ?;"
+	MySQLTableIndexs         = "SELECT INDEX_NAME, INDEX_TYPE FROM information_schema.statistics WHERE TABLE_NAME = ?;"
+	MySQLTableColumns        = "SELECT COLUMN_NAME, DATA_TYPE, IS_NULLABLE, CHARACTER_MAXIMUM_LENGTH, CHARACTER_SET_NAME, COLUMN_DEFAULT, NUMERIC_PRECISION, NUMERIC_SCALE, DATETIME_PRECISION FROM information_schema.columns WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION;"
+	MySQLTablePrimaryKey     = "SELECT COLUMN_NAME FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND INDEX_NAME = 'PRIMARY' ORDER BY SEQ_IN_INDEX;"
+	MySQLTableRowEstimate    = "SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?;"
+	MySQLTableUniqueKeys     = "SELECT INDEX_NAME, COLUMN_NAME FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND NON_UNIQUE = 0 ORDER BY INDEX_NAME = 'PRIMARY' DESC, INDEX_NAME, SEQ_IN_INDEX;"
+	MySQLProcedureParameters = "SELECT PARAMETER_MODE, PARAMETER_NAME, DATA_TYPE, ORDINAL_POSITION FROM information_schema.parameters where SPECIFIC_NAME = ? and SPECIFIC_SCHEMA = ? order by ORDINAL_POSITION"
 	MySQLAllCollationCharSet = "SELECT COLLATION_NAME, CHARACTER_SET_NAME FROM INFORMATION_SCHEMA.COLLATION_CHARACTER_SET_APPLICABILITY"
+	MySQLUseDatabase         = "USE %s;"
 	MySQLDatabaseAlter       = "ALTER DATABASE %s CHARACTER SET %s COLLATE %s;"
 	MySQLDatabaseDrop        = "DROP DATABASE %s"
 	MySQLTableDrop           = "DROP TABLE %s.%s"
 	MySQLTableTruncate       = "TRUNCATE TABLE %s.%s"
+	MySQLCellLength          = "SELECT CHAR_LENGTH(%s) FROM %s WHERE %s LIMIT 1"
+	MySQLSelectCellChunk     = "SELECT SUBSTRING(%s, ?, ?) FROM %s WHERE %s LIMIT 1"
+	MySQLInsertRows          = "INSERT INTO %s (%s) VALUES %s"
+	MySQLUpdateRow           = "UPDATE %s SET %s WHERE %s LIMIT 1"
+	MySQLDeleteRow           = "DELETE FROM %s WHERE %s LIMIT 1"
+	MySQLLockRow             = "SELECT 1 FROM %s WHERE %s FOR UPDATE"
+	MySQLSavepointEdit       = "SAVEPOINT mysqlweb_edit"
+	MySQLRollbackEdit        = "ROLLBACK TO SAVEPOINT mysqlweb_edit"
+	MySQLReleaseEdit         = "RELEASE SAVEPOINT mysqlweb_edit"
+	MySQLCreateTable         = "CREATE TABLE %s (\n%s\n)"
+	MySQLShowCreateTable     = "SHOW CREATE TABLE %s.%s"
+	MySQLVersion             = "SELECT VERSION()"
+	MySQLDumpIsolation       = "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ"
+	MySQLDumpSnapshot        = "START TRANSACTION WITH CONSISTENT SNAPSHOT"
+	MySQLDumpColumns         = "SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND EXTRA NOT IN ('VIRTUAL GENERATED', 'STORED GENERATED') ORDER BY ORDINAL_POSITION;"
+	MySQLDumpSelect          = "SELECT %s FROM %s"
+	MySQLDumpDropTable       = "DROP TABLE IF EXISTS %s;"
+	MySQLDumpDropView        = "DROP VIEW IF EXISTS %s;"
+	MySQLDumpStandInView     = "CREATE VIEW %s AS SELECT %s;"
+	MySQLDumpDropRoutine     = "DROP %s IF EXISTS %s;"
+	MySQLDumpHeader          = "SET NAMES utf8mb4;\nSET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;\nSET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;\n"
+	MySQLDumpFooter          = "SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;\nSET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;\n"
 	MySQLProcedureDefinition = "SHOW CREATE %s %s.%s"
 	MySQLProcedureDrop       = "DROP %s IF EXISTS %s.%s"
 	MySQLViewDefinition      = "SHOW CREATE VIEW %s.%s"
-	MySQLSearchTable         = "SELECT TABLE_NAME, TABLE_SCHEMA, 'TBL' AS type FROM information_schema.TABLES WHERE TABLE_TYPE = 'BASE TABLE' AND TABLE_NAME LIKE '%%%s%%' ORDER BY TABLE_NAME;"
-	MySQLSearchProcedure     = "SELECT ROUTINE_NAME, ROUTINE_SCHEMA, 'PROC' AS type FROM INFORMATION_SCHEMA.ROUTINES WHERE ROUTINE_TYPE= 'PROCEDURE' AND ROUTINE_NAME LIKE '%%%s%%' ORDER BY ROUTINE_NAME;"
-	MySQLSearchFunction      = "SELECT ROUTINE_NAME, ROUTINE_SCHEMA, 'FUNC' AS type FROM INFORMATION_SCHEMA.ROUTINES WHERE ROUTINE_TYPE= 'FUNCTION' AND ROUTINE_NAME LIKE '%%%s%%' ORDER BY ROUTINE_NAME;"
+	MySQLSearchTable         = "SELECT TABLE_NAME, TABLE_SCHEMA, 'TBL' AS type FROM information_schema.TABLES WHERE TABLE_TYPE = 'BASE TABLE' AND TABLE_NAME LIKE ? ESCAPE '!' ORDER BY TABLE_NAME;"
+	MySQLSearchProcedure     = "SELECT ROUTINE_NAME, ROUTINE_SCHEMA, 'PROC' AS type FROM INFORMATION_SCHEMA.ROUTINES WHERE ROUTINE_TYPE= 'PROCEDURE' AND ROUTINE_NAME LIKE ? ESCAPE '!' ORDER BY ROUTINE_NAME;"
+	MySQLSearchFunction      = "SELECT ROUTINE_NAME, ROUTINE_SCHEMA, 'FUNC' AS type FROM INFORMATION_SCHEMA.ROUTINES WHERE ROUTINE_TYPE= 'FUNCTION' AND ROUTINE_NAME LIKE ? ESCAPE '!' ORDER BY ROUTINE_NAME;"
 )
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// RowWriter receives a resultset row by row as it is read from the database
+type RowWriter interface {
+	// WriteColumns is called once, before any row is written
+	WriteColumns(columns []ColumnInfo) error
+	WriteRow(row Row) error
+	// Close finishes the output. truncated reports whether the row limit was
+	// hit, err holds the error that interrupted reading the rows, if any.
+	Close(truncated bool, err error) error
+}
+
+// RowsAffectedWriter is implemented by the writers reporting the number of
+// rows affected by statements without resultset, such as UPDATE
+type RowsAffectedWriter interface {
+	// SetRowsAffected is called before WriteColumns, which then gets no
+	// column
+	SetRowsAffected(count int64)
+}
+
+// jsonRowWriter streams the resultset in the same shape as Result, with
+// extra truncated, rows_affected, warnings and error fields
+type jsonRowWriter struct {
+	w            http.ResponseWriter
+	rows         int
+	rowsAffected *int64
+	warnings     []string
+}
+
+func newJSONRowWriter(w http.ResponseWriter) *jsonRowWriter {
+	return &jsonRowWriter{w: w}
+}
+
+func (jw *jsonRowWriter) WriteColumns(columns []ColumnInfo) error {
+	names, err := json.Marshal(columnNames(columns))
+	if err != nil {
+		return err
+	}
+
+	types, err := json.Marshal(columns)
+	if err != nil {
+		return err
+	}
+
+	jw.w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	return jw.write(`{"columns":`, string(names), `,"column_types":`, string(types), `,"rows":[`)
+}
+
+func (jw *jsonRowWriter) WriteRow(row Row) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	sep := ""
+	if jw.rows > 0 {
+		sep = ","
+	}
+	jw.rows++
+
+	return jw.write(sep, string(data))
+}
+
+func (jw *jsonRowWriter) SetRowsAffected(count int64) {
+	jw.rowsAffected = &count
+}
+
+func (jw *jsonRowWriter) Close(truncated bool, err error) error {
+	if err := jw.write(`],"truncated":`, strconv.FormatBool(truncated)); err != nil {
+		return err
+	}
+
+	if jw.rowsAffected != nil {
+		if err := jw.write(`,"rows_affected":`, strconv.FormatInt(*jw.rowsAffected, 10)); err != nil {
+			return err
+		}
+	}
+
+	if len(jw.warnings) > 0 {
+		data, _ := json.Marshal(jw.warnings)
+		if err := jw.write(`,"warnings":`, string(data)); err != nil {
+			return err
+		}
+	}
+
+	if err != nil {
+		data, _ := json.Marshal(err.Error())
+		if err := jw.write(`,"error":`, string(data)); err != nil {
+			return err
+		}
+	}
+
+	return jw.write("}")
+}
+
+func (jw *jsonRowWriter) write(parts ...string) error {
+	for _, part := range parts {
+		if _, err := jw.w.Write([]byte(part)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
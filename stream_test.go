@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeRows(w RowWriter, rows []Row, truncated bool, err error) {
+	w.WriteColumns([]ColumnInfo{{Name: "id", Type: "INT"}, {Name: "name", Type: "VARCHAR"}})
+	for _, row := range rows {
+		w.WriteRow(row)
+	}
+	w.Close(truncated, err)
+}
+
+func TestJSONRowWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeRows(newJSONRowWriter(rec), []Row{{1, "a"}, {2, nil}}, true, nil)
+
+	var out map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &out))
+	assert.Equal(t, []interface{}{"id", "name"}, out["columns"])
+	assert.Len(t, out["rows"], 2)
+	assert.Equal(t, true, out["truncated"])
+	assert.Nil(t, out["error"])
+}
+
+func TestJSONRowWriter_Error(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeRows(newJSONRowWriter(rec), nil, false, errors.New("connection lost"))
+
+	var out map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &out))
+	assert.Len(t, out["rows"], 0)
+	assert.Equal(t, "connection lost", out["error"])
+}
+
+func TestJSONRowWriter_RowsAffected(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := newJSONRowWriter(rec)
+	w.SetRowsAffected(3)
+	w.WriteColumns([]ColumnInfo{})
+	w.Close(false, nil)
+
+	assert.JSONEq(t, `{"columns":[],"column_types":[],"rows":[],"truncated":false,"rows_affected":3}`, rec.Body.String())
+}
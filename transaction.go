@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Transaction statements
+const (
+	MySQLBeginTransaction    = "START TRANSACTION"
+	MySQLCommitTransaction   = "COMMIT"
+	MySQLRollbackTransaction = "ROLLBACK"
+)
+
+var (
+	// ErrTransactionOpen is returned when beginning a transaction while
+	// another one is open
+	ErrTransactionOpen = errors.New("A transaction is already open")
+
+	// ErrNoTransaction is returned when committing or rolling back without
+	// an open transaction
+	ErrNoTransaction = errors.New("There is no open transaction")
+
+	// ErrTransactionLost is returned when the session connection was lost
+	// while a transaction was open, the server rolling it back
+	ErrTransactionLost = errors.New("The connection was lost, the open transaction was rolled back")
+)
+
+// TransactionState describes the explicit transaction of a session
+type TransactionState struct {
+	Active   bool       `json:"active"`
+	Started  *time.Time `json:"started,omitempty"`
+	Duration int64      `json:"duration_ms,omitempty"`
+}
+
+// Transaction returns the state of the session transaction
+func (client *Client) Transaction() TransactionState {
+	client.mu.Lock()
+	started := client.txStarted
+	client.mu.Unlock()
+
+	if started.IsZero() {
+		return TransactionState{}
+	}
+
+	return TransactionState{
+		Active:   true,
+		Started:  &started,
+		Duration: time.Since(started).Milliseconds(),
+	}
+}
+
+// InTransaction reports whether the session has an open transaction
+func (client *Client) InTransaction() bool {
+	return client.Transaction().Active
+}
+
+// Begin opens a transaction on the session connection. Queries run until
+// Commit or Rollback are part of it.
+func (client *Client) Begin(ctx context.Context) error {
+	if client.InTransaction() {
+		return ErrTransactionOpen
+	}
+
+	return client.transactionStatement(ctx, MySQLBeginTransaction)
+}
+
+// Commit commits the session transaction
+func (client *Client) Commit(ctx context.Context) error {
+	if !client.InTransaction() {
+		return ErrNoTransaction
+	}
+
+	return client.transactionStatement(ctx, MySQLCommitTransaction)
+}
+
+// Rollback rolls the session transaction back
+func (client *Client) Rollback(ctx context.Context) error {
+	if !client.InTransaction() {
+		return ErrNoTransaction
+	}
+
+	return client.transactionStatement(ctx, MySQLRollbackTransaction)
+}
+
+func (client *Client) transactionStatement(ctx context.Context, query string) error {
+	return client.withSession(ctx, func(ctx context.Context, conn *sqlx.Conn, threadID int64) error {
+		start := time.Now()
+		_, err := conn.ExecContext(ctx, query)
+
+		client.recordExecution(Query{Query: query, Database: client.sessionDatabase(), Origin: OriginUser}, start, err)
+
+		if err != nil {
+			return err
+		}
+
+		client.trackTransaction(query)
+
+		return nil
+	})
+}
+
+// implicitCommits are the statements, besides DDL and LOCK TABLES, which
+// end the open transaction
+var implicitCommits = map[string]bool{
+	"ANALYZE":  true,
+	"CHECK":    true,
+	"OPTIMIZE": true,
+	"REPAIR":   true,
+	"CACHE":    true,
+	"FLUSH":    true,
+	"RESET":    true,
+}
+
+// trackTransaction updates the transaction state after the statement ran
+// successfully on the session connection
+func (client *Client) trackTransaction(query string) {
+	info := classifyStatement(query)
+
+	// Words following the statement type, e.g. TRANSACTION or TO SAVEPOINT.
+	// The optional WORK of BEGIN, COMMIT and ROLLBACK is skipped.
+	var words []string
+	for _, token := range tokenize(query) {
+		if token.Kind == tokenWord && !(len(words) == 1 && token.is("WORK")) {
+			words = append(words, strings.ToUpper(token.Value))
+		}
+	}
+	next := func(i int) string {
+		if i < len(words) {
+			return words[i]
+		}
+		return ""
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	switch {
+	case info.Type == "BEGIN", info.Type == "START" && next(1) == "TRANSACTION":
+		// Beginning while a transaction is open commits it first
+		client.txStarted = time.Now()
+	case info.Type == "COMMIT", info.Type == "ROLLBACK":
+		switch {
+		case info.Type == "ROLLBACK" && next(1) == "TO":
+			// Rolling back to a savepoint keeps the transaction open
+		case next(1) == "AND" && next(2) == "CHAIN":
+			client.txStarted = time.Now()
+		default:
+			client.txStarted = time.Time{}
+		}
+	case info.Kind == KindDDL:
+		// Temporary tables are the exception
+		if next(1) != "TEMPORARY" {
+			client.txStarted = time.Time{}
+		}
+	case implicitCommits[info.Type], info.Type == "LOCK" && strings.HasPrefix(next(1), "TABLE"), enablesAutocommit(query):
+		client.txStarted = time.Time{}
+	}
+}
+
+// enablesAutocommit reports whether the statement is a SET autocommit = 1,
+// which commits the open transaction
+func enablesAutocommit(query string) bool {
+	tokens := tokenize(query)
+	if len(tokens) == 0 || !tokens[0].is("SET") {
+		return false
+	}
+
+	for i := 0; i+2 < len(tokens); i++ {
+		name := strings.ToLower(strings.TrimLeft(tokens[i].Value, "@"))
+		name = strings.TrimPrefix(strings.TrimPrefix(name, "session."), "local.")
+
+		if name == "autocommit" && (tokens[i+1].is("=") || tokens[i+1].is(":=")) {
+			value := tokens[i+2]
+			return value.Value == "1" || value.is("ON") || value.is("TRUE")
+		}
+	}
+
+	return false
+}
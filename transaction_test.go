@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackTransaction(t *testing.T) {
+	client := newTestClient(t)
+
+	client.trackTransaction("START SLAVE")
+	assert.False(t, client.InTransaction())
+
+	client.trackTransaction("begin")
+	assert.True(t, client.InTransaction())
+
+	client.trackTransaction("ROLLBACK TO SAVEPOINT s1")
+	assert.True(t, client.InTransaction())
+
+	client.trackTransaction("ROLLBACK")
+	assert.False(t, client.InTransaction())
+
+	client.trackTransaction("START TRANSACTION READ ONLY")
+	assert.True(t, client.InTransaction())
+
+	client.trackTransaction("COMMIT")
+	assert.False(t, client.InTransaction())
+
+	client.trackTransaction("BEGIN WORK")
+	client.trackTransaction("COMMIT WORK AND CHAIN")
+	assert.True(t, client.InTransaction())
+	client.trackTransaction("rollback work")
+	assert.False(t, client.InTransaction())
+}
+
+func TestTrackTransaction_ImplicitCommit(t *testing.T) {
+	client := newTestClient(t)
+
+	ending := []string{
+		"CREATE TABLE t (id INT)",
+		"/* ddl */ ALTER TABLE t ADD COLUMN a INT",
+		"DROP TABLE t",
+		"TRUNCATE t",
+		"RENAME TABLE a TO b",
+		"GRANT SELECT ON db.* TO 'app'",
+		"LOCK TABLES t READ",
+		"ANALYZE TABLE t",
+		"FLUSH PRIVILEGES",
+		"SET autocommit = 1",
+		"SET @@session.autocommit = ON",
+	}
+
+	for _, query := range ending {
+		client.trackTransaction("START TRANSACTION")
+		client.trackTransaction(query)
+		assert.False(t, client.InTransaction(), query)
+	}
+
+	keeping := []string{
+		"CREATE TEMPORARY TABLE tmp (id INT)",
+		"DROP TEMPORARY TABLE tmp",
+		"INSERT INTO t VALUES (1)",
+		"SET autocommit = 0",
+		"SELECT 'DROP TABLE t'",
+		"LOCK INSTANCE FOR BACKUP",
+	}
+
+	for _, query := range keeping {
+		client.trackTransaction("START TRANSACTION")
+		client.trackTransaction(query)
+		assert.True(t, client.InTransaction(), query)
+		client.trackTransaction("ROLLBACK")
+	}
+}
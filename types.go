@@ -0,0 +1,227 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSafeInteger is the largest integer a JavaScript number holds exactly,
+// larger ones are sent as strings
+const maxSafeInteger = 1<<53 - 1
+
+// Encodings of binary values
+const (
+	BinaryHex    = "hex"
+	BinaryBase64 = "base64"
+)
+
+// binaryTypes are the column types holding raw bytes
+var binaryTypes = map[string]bool{
+	"BINARY":     true,
+	"VARBINARY":  true,
+	"TINYBLOB":   true,
+	"BLOB":       true,
+	"MEDIUMBLOB": true,
+	"LONGBLOB":   true,
+	"GEOMETRY":   true,
+}
+
+// Binary is the value of a binary column. It is encoded in full in exports
+// and as a preview limited to --blob-preview bytes in the JSON of the grid,
+// as it can't show it anyway.
+type Binary []byte
+
+// String encodes the whole value with the --binary-encoding
+func (b Binary) String() string {
+	return encodeBinary(b, options.BinaryEncoding)
+}
+
+// Preview encodes at most limit bytes of the value, 0 means no limit. An
+// ellipsis is appended when the value is cut.
+func (b Binary) Preview(limit int) string {
+	if limit > 0 && len(b) > limit {
+		return encodeBinary(b[:limit], options.BinaryEncoding) + "…"
+	}
+
+	return b.String()
+}
+
+func (b Binary) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.Preview(options.BlobPreview))
+}
+
+// encodeBinary encodes data as base64 or as a 0x prefixed hex literal,
+// the default
+func encodeBinary(data []byte, encoding string) string {
+	if encoding == BinaryBase64 {
+		return base64.StdEncoding.EncodeToString(data)
+	}
+
+	return "0x" + strings.ToUpper(hex.EncodeToString(data))
+}
+
+// decodeBinary reverses encodeBinary: 0x prefixed values are read as hex,
+// others as base64 when it is the --binary-encoding and as raw bytes
+// otherwise
+func decodeBinary(text string) ([]byte, error) {
+	if strings.HasPrefix(text, "0x") || strings.HasPrefix(text, "0X") {
+		return hex.DecodeString(text[2:])
+	}
+
+	if options.BinaryEncoding == BinaryBase64 {
+		return base64.StdEncoding.DecodeString(text)
+	}
+
+	return []byte(text), nil
+}
+
+// validateBinaryEncoding checks the encoding is one of the supported ones
+func validateBinaryEncoding(encoding string) error {
+	switch encoding {
+	case BinaryHex, BinaryBase64:
+		return nil
+	}
+
+	return fmt.Errorf("Invalid binary encoding %q, expected hex or base64", encoding)
+}
+
+// ColumnInfo describes a column of a resultset
+type ColumnInfo struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Nullable  *bool  `json:"nullable,omitempty"`
+	Length    *int64 `json:"length,omitempty"`
+	Precision *int64 `json:"precision,omitempty"`
+	Scale     *int64 `json:"scale,omitempty"`
+}
+
+// newColumnInfo builds the description of a column from the driver metadata
+func newColumnInfo(columnType *sql.ColumnType) ColumnInfo {
+	info := ColumnInfo{
+		Name: columnType.Name(),
+		Type: columnType.DatabaseTypeName(),
+	}
+
+	if nullable, ok := columnType.Nullable(); ok {
+		info.Nullable = &nullable
+	}
+
+	if length, ok := columnType.Length(); ok {
+		info.Length = &length
+	}
+
+	if precision, scale, ok := columnType.DecimalSize(); ok {
+		info.Precision = &precision
+		info.Scale = &scale
+	}
+
+	return info
+}
+
+// columnInfos describes the columns of the resultset
+func columnInfos(columnTypes []*sql.ColumnType) []ColumnInfo {
+	infos := make([]ColumnInfo, len(columnTypes))
+
+	for i, columnType := range columnTypes {
+		infos[i] = newColumnInfo(columnType)
+	}
+
+	return infos
+}
+
+// columnNames returns the names of the columns
+func columnNames(columns []ColumnInfo) []string {
+	names := make([]string, len(columns))
+
+	for i, column := range columns {
+		names[i] = column.Name
+	}
+
+	return names
+}
+
+// baseType returns the type name without the UNSIGNED prefix
+func baseType(typeName string) string {
+	return strings.TrimPrefix(strings.ToUpper(typeName), "UNSIGNED ")
+}
+
+// decodeValue converts a value scanned from the database into the Go type
+// matching its column type, so it is encoded as the proper JSON type:
+// integers and floats as numbers, exact decimals as strings, dates and
+// times in ISO 8601, JSON documents as they are and raw bytes as Binary.
+func decodeValue(value interface{}, typeName string) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	if t, ok := value.(time.Time); ok {
+		if baseType(typeName) == "DATE" {
+			return t.Format("2006-01-02")
+		}
+		return t.Format("2006-01-02T15:04:05.999999999")
+	}
+
+	raw, ok := value.([]byte)
+	if !ok {
+		// Already typed by the driver (binary protocol)
+		switch v := value.(type) {
+		case int64:
+			if v > maxSafeInteger || v < -maxSafeInteger {
+				return strconv.FormatInt(v, 10)
+			}
+		case uint64:
+			if v > maxSafeInteger {
+				return strconv.FormatUint(v, 10)
+			}
+		}
+		return value
+	}
+
+	if binaryTypes[baseType(typeName)] {
+		return Binary(raw)
+	}
+
+	text := string(raw)
+
+	switch baseType(typeName) {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "YEAR":
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			if n > maxSafeInteger || n < -maxSafeInteger {
+				return text
+			}
+			return n
+		}
+		return text
+	case "FLOAT", "DOUBLE", "REAL":
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return f
+		}
+		return text
+	case "DATETIME", "TIMESTAMP":
+		// Zero dates can't be represented, keep them as they are
+		if strings.HasPrefix(text, "0000-00-00") {
+			return text
+		}
+		return strings.Replace(text, " ", "T", 1)
+	case "BIT":
+		var n uint64
+		for _, b := range raw {
+			n = n<<8 | uint64(b)
+		}
+		return n
+	case "JSON":
+		if json.Valid(raw) {
+			return json.RawMessage(raw)
+		}
+		return text
+	}
+
+	// DECIMAL, DATE, TIME, strings...
+	return text
+}
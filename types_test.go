@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeValue(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		typeName string
+		expected interface{}
+	}{
+		{nil, "INT", nil},
+		{[]byte("42"), "INT", int64(42)},
+		{[]byte("-7"), "TINYINT", int64(-7)},
+		{[]byte("18446744073709551615"), "UNSIGNED BIGINT", "18446744073709551615"},
+		{[]byte("9007199254740993"), "BIGINT", "9007199254740993"},
+		{[]byte("2024"), "YEAR", int64(2024)},
+		{[]byte("12345678901234567890.123456789"), "DECIMAL", "12345678901234567890.123456789"},
+		{[]byte("1.5"), "DOUBLE", 1.5},
+		{[]byte("2024-03-01"), "DATE", "2024-03-01"},
+		{[]byte("2024-03-01 10:20:30.123"), "DATETIME", "2024-03-01T10:20:30.123"},
+		{[]byte("0000-00-00 00:00:00"), "TIMESTAMP", "0000-00-00 00:00:00"},
+		{[]byte("838:59:59"), "TIME", "838:59:59"},
+		{[]byte{0x01, 0x02}, "BIT", uint64(258)},
+		{[]byte(`{"a":1}`), "JSON", json.RawMessage(`{"a":1}`)},
+		{[]byte("héllo"), "VARCHAR", "héllo"},
+		{[]byte{0xff, 0x00}, "BLOB", Binary{0xff, 0x00}},
+		{[]byte{0x01}, "VARBINARY", Binary{0x01}},
+		{int64(5), "BIGINT", int64(5)},
+		{int64(1 << 60), "BIGINT", "1152921504606846976"},
+		{time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC), "DATETIME", "2024-03-01T10:20:30"},
+		{time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), "DATE", "2024-03-01"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, decodeValue(test.value, test.typeName), test.typeName)
+	}
+}
+
+func TestColumnNames(t *testing.T) {
+	cols := []ColumnInfo{{Name: "id"}, {Name: "name"}}
+
+	assert.Equal(t, []string{"id", "name"}, columnNames(cols))
+}
+
+func TestBinaryPreview(t *testing.T) {
+	data := Binary{0x89, 0x50, 0x4e, 0x47}
+
+	assert.Equal(t, "0x89504E47", data.String())
+	assert.Equal(t, "0x8950…", data.Preview(2))
+	assert.Equal(t, "0x89504E47", data.Preview(0))
+
+	options.BinaryEncoding = BinaryBase64
+	defer func() { options.BinaryEncoding = "" }()
+
+	assert.Equal(t, "iVBORw==", data.String())
+}
+
+func TestBinaryMarshalJSON(t *testing.T) {
+	options.BlobPreview = 1
+	defer func() { options.BlobPreview = 0 }()
+
+	out, err := json.Marshal(Row{Binary{0xca, 0xfe}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `["0xCA…"]`, string(out))
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
@@ -11,6 +14,13 @@ import (
 
 const MEGABYTE = 1024 * 1024
 
+// charsetNameRegex matches valid character set & collation names
+var charsetNameRegex = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// savedNameRegex matches the names of the items saved one per file, such as
+// bookmarks and snippets, which can't point outside of their directory
+var savedNameRegex = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_ .-]{0,63}$`)
+
 func startRuntimeProfiler() {
 	m := &runtime.MemStats{}
 
@@ -26,6 +36,64 @@ func startRuntimeProfiler() {
 	}
 }
 
+// quoteIdentifier wraps a schema object name (database, table, column...) in
+// backticks, doubling any backtick it contains, so it can be safely used in a
+// statement
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// qualifiedName returns the quoted database.object name
+func qualifiedName(database string, name string) string {
+	return quoteIdentifier(database) + "." + quoteIdentifier(name)
+}
+
+// safeFilename replaces the characters that can't be used in a file name or
+// in a Content-Disposition header
+func safeFilename(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '"' || r == '/' || r == '\\' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// escapeLike escapes the LIKE wildcards of a search term, using ! as the
+// escape character
+func escapeLike(term string) string {
+	replacer := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+	return replacer.Replace(term)
+}
+
+// routineType validates the type of a stored routine
+func routineType(procType string) (string, error) {
+	procType = strings.ToUpper(procType)
+
+	if procType != "PROCEDURE" && procType != "FUNCTION" {
+		return "", fmt.Errorf("Invalid routine type: %s", procType)
+	}
+
+	return procType, nil
+}
+
+// validateCharsetName makes sure a character set or collation name can be
+// used in a statement, they can't be quoted as identifiers
+func validateCharsetName(name string) error {
+	if !charsetNameRegex.MatchString(name) {
+		return errors.New("Invalid character set or collation name")
+	}
+
+	return nil
+}
+
+// validSavedName reports whether name can be used as the file name of a
+// saved item: letters, digits, spaces, dots, dashes and underscores, not
+// starting with a dot
+func validSavedName(name string) bool {
+	return savedNameRegex.MatchString(name)
+}
+
 func splice(s string, idx int, rem int, sAdd string) string {
 	return (s[0:idx] + sAdd + s[(idx+rem):])
 }
@@ -66,6 +134,37 @@ func getConnParametersFromString(url string) (string, string, string, int) {
 	return userName, hostName, database, port
 }
 
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it over path, so readers never see a half written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	tmp := file.Name()
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+	}
+
+	return err
+}
+
 // exists returns whether the given file or directory exists or not
 func ExistsFileFolder(path string) (bool, error) {
 	_, err := os.Stat(path)
@@ -47,3 +47,43 @@ func TestComapreVersion_BothAreSame(t *testing.T) {
 
 	assert.Equal(t, 0, isUpdate)
 }
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"users":          "`users`",
+		"my`table":       "`my``table`",
+		"``":             "``````",
+		"it's":           "`it's`",
+		`say "hi"`:       "`say \"hi\"`",
+		"x`; DROP t; --": "`x``; DROP t; --`",
+		"café_日本":        "`café_日本`",
+	}
+
+	for name, expected := range tests {
+		assert.Equal(t, expected, quoteIdentifier(name))
+	}
+}
+
+func TestQualifiedName(t *testing.T) {
+	assert.Equal(t, "`my``db`.`o'brien`", qualifiedName("my`db", "o'brien"))
+}
+
+func TestEscapeLike(t *testing.T) {
+	assert.Equal(t, "50!% off!_now!!", escapeLike("50% off_now!"))
+	assert.Equal(t, "it's `ü`", escapeLike("it's `ü`"))
+}
+
+func TestRoutineType(t *testing.T) {
+	procType, err := routineType("procedure")
+	assert.NoError(t, err)
+	assert.Equal(t, "PROCEDURE", procType)
+
+	_, err = routineType("TABLE x; DROP")
+	assert.Error(t, err)
+}
+
+func TestValidateCharsetName(t *testing.T) {
+	assert.NoError(t, validateCharsetName("utf8mb4_unicode_ci"))
+	assert.Error(t, validateCharsetName("utf8; DROP DATABASE x"))
+	assert.Error(t, validateCharsetName(""))
+}